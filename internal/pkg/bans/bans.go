@@ -0,0 +1,71 @@
+package bans
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/nezorflame/opengapps-mirror-bot/internal/pkg/db"
+)
+
+const bucketName = "bans"
+
+// Ban describes the banned user
+type Ban struct {
+	UserID    int       `json:"user_id"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Store stores the banned users in the DB
+type Store struct {
+	bucket *db.Bucket
+}
+
+// NewStore creates a new Store instance
+func NewStore(cache *db.DB) (*Store, error) {
+	bucket, err := cache.Bucket(bucketName)
+	if err != nil {
+		return nil, fmt.Errorf("unable to init bans bucket: %w", err)
+	}
+	return &Store{bucket: bucket}, nil
+}
+
+// Add bans the user
+func (s *Store) Add(userID int, reason string) error {
+	body, err := json.Marshal(&Ban{UserID: userID, Reason: reason, CreatedAt: time.Now()})
+	if err != nil {
+		return fmt.Errorf("unable to marshal ban: %w", err)
+	}
+	if err = s.bucket.Put(strconv.Itoa(userID), body); err != nil {
+		return fmt.Errorf("unable to save ban: %w", err)
+	}
+	return nil
+}
+
+// Remove unbans the user and returns whether the user was banned
+func (s *Store) Remove(userID int) (bool, error) {
+	banned, err := s.Banned(userID)
+	if err != nil || !banned {
+		return false, err
+	}
+	if err = s.bucket.Delete(strconv.Itoa(userID)); err != nil {
+		return false, fmt.Errorf("unable to delete ban: %w", err)
+	}
+	return true, nil
+}
+
+// Banned checks if the user is banned
+func (s *Store) Banned(userID int) (bool, error) {
+	_, err := s.bucket.Get(strconv.Itoa(userID))
+	switch {
+	case err == nil:
+		return true, nil
+	case errors.Is(err, db.ErrNotFound):
+		return false, nil
+	default:
+		return false, fmt.Errorf("unable to get ban: %w", err)
+	}
+}
@@ -3,6 +3,9 @@ package config
 import (
 	"errors"
 	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
 	"time"
 
 	"github.com/spf13/viper"
@@ -11,40 +14,57 @@ import (
 const (
 	msgEmptyValue = "empty config value '%s'"
 
+	defaultDownloadRetries  = 5
+	defaultDownloadChunks   = 20
 	defaultDBPath           = "./bolt.db"
 	defaultDBTimeout        = time.Second
 	defaultTelegramTimeout  = 60
 	defaultTelegramDebug    = false
+	defaultProgressInterval = 3 * time.Second
 	defaultGAppsRenewPeriod = time.Minute
+	defaultGAppsSweepPeriod = time.Hour
+	defaultGAppsExpiry      = "hide"
+	defaultGAppsTimeout     = 30 * time.Minute
+	defaultFilesPrefix      = "/files/"
+	defaultAPIPrefix        = "/api/"
+	defaultMetricsPath      = "/metrics"
+	defaultTelegramMode     = "polling"
+	defaultLocale           = "en"
+	defaultReleasesTTL      = 6 * time.Hour
+	defaultUserRequests     = 20
+	defaultChatRequests     = 60
+	defaultDownloadRequests = 5
+	defaultLimitPeriod      = time.Minute
+	defaultDownloadPeriod   = 10 * time.Minute
 )
 
+// webhookSecretRegexp describes the secret tokens allowed by Telegram
+var webhookSecretRegexp = regexp.MustCompile(`^[A-Za-z0-9_-]{1,256}$`)
+
 var mandatoryParams = []string{
 	"max_downloads",
 	"gapps.time_format",
 	"gapps.prefix",
-	"gapps.local_path",
-	"gapps.local_url",
-	"gapps.local_host",
 	"github.repo",
 	"github.token",
 	"telegram.token",
 	"commands.start",
 	"commands.help",
 	"commands.mirror",
-	"messages.hello",
-	"messages.help",
-	"messages.mirror.in_progress",
-	"messages.mirror.found",
-	"messages.mirror.not_found",
-	"messages.mirror.missing",
-	"messages.mirror.ok",
-	"messages.mirror.fail",
-	"messages.errors.platform",
-	"messages.errors.android",
-	"messages.errors.variant",
-	"messages.errors.date",
-	"messages.errors.mirror",
-	"messages.errors.unknown",
+	"commands.subscribe",
+	"commands.unsubscribe",
+	"commands.cancel",
+	"commands.language",
+	"commands.dates",
+	"commands.list",
+	"commands.diff",
+	"commands.refresh",
+	"commands.storages",
+	"commands.purge",
+	"commands.remirror",
+	"commands.stats",
+	"commands.ban",
+	"commands.unban",
 }
 
 // New creates new viper config instance
@@ -66,11 +86,29 @@ func New(name string) (*viper.Viper, error) {
 	}
 	cfg.WatchConfig()
 
+	cfg.SetDefault("download_retries", defaultDownloadRetries)
+	cfg.SetDefault("download_chunks", defaultDownloadChunks)
 	cfg.SetDefault("db.path", defaultDBPath)
 	cfg.SetDefault("db.timeout", defaultDBTimeout)
 	cfg.SetDefault("gapps.renew_period", defaultGAppsRenewPeriod)
+	cfg.SetDefault("gapps.sweep_period", defaultGAppsSweepPeriod)
+	cfg.SetDefault("gapps.expiry_policy", defaultGAppsExpiry)
+	cfg.SetDefault("gapps.mirror_timeout", defaultGAppsTimeout)
+	cfg.SetDefault("gapps.releases_ttl", defaultReleasesTTL)
+	cfg.SetDefault("http.files.prefix", defaultFilesPrefix)
+	cfg.SetDefault("http.api.prefix", defaultAPIPrefix)
+	cfg.SetDefault("http.metrics.path", defaultMetricsPath)
 	cfg.SetDefault("telegram.timeout", defaultTelegramTimeout)
 	cfg.SetDefault("telegram.debug", defaultTelegramDebug)
+	cfg.SetDefault("telegram.progress_interval", defaultProgressInterval)
+	cfg.SetDefault("telegram.mode", defaultTelegramMode)
+	cfg.SetDefault("i18n.default", defaultLocale)
+	cfg.SetDefault("limits.user.requests", defaultUserRequests)
+	cfg.SetDefault("limits.user.period", defaultLimitPeriod)
+	cfg.SetDefault("limits.chat.requests", defaultChatRequests)
+	cfg.SetDefault("limits.chat.period", defaultLimitPeriod)
+	cfg.SetDefault("limits.download.requests", defaultDownloadRequests)
+	cfg.SetDefault("limits.download.period", defaultDownloadPeriod)
 
 	if err := validateConfig(cfg); err != nil {
 		return nil, fmt.Errorf("unable to validate config: %w", err)
@@ -94,6 +132,14 @@ func validateConfig(cfg *viper.Viper) error {
 		return errors.New("'max_downloads' should be greater than 0")
 	}
 
+	if cfg.GetInt("download_retries") < 0 {
+		return errors.New("'download_retries' should not be negative")
+	}
+
+	if cfg.GetInt("download_chunks") <= 0 {
+		return errors.New("'download_chunks' should be greater than 0")
+	}
+
 	if cfg.GetDuration("db.timeout") <= 0 {
 		return errors.New("'db.timeout' should be greater than 0")
 	}
@@ -102,9 +148,105 @@ func validateConfig(cfg *viper.Viper) error {
 		return errors.New("'gapps.renew_period' should be greater than 0")
 	}
 
+	if cfg.GetDuration("gapps.sweep_period") <= 0 {
+		return errors.New("'gapps.sweep_period' should be greater than 0")
+	}
+
+	if p := cfg.GetString("gapps.expiry_policy"); p != "hide" && p != "reupload" {
+		return fmt.Errorf("unknown 'gapps.expiry_policy' value '%s'", p)
+	}
+
+	if cfg.GetDuration("gapps.mirror_timeout") <= 0 {
+		return errors.New("'gapps.mirror_timeout' should be greater than 0")
+	}
+
+	if cfg.GetDuration("gapps.releases_ttl") <= 0 {
+		return errors.New("'gapps.releases_ttl' should be greater than 0")
+	}
+
+	if cfg.GetInt("gapps.premirror.top") < 0 {
+		return errors.New("'gapps.premirror.top' should not be negative")
+	}
+
+	if cfg.GetBool("http.files.enabled") {
+		if cfg.GetString("http.listen") == "" {
+			return errors.New("'http.listen' should be set to enable the file server")
+		}
+		if cfg.GetString("http.files.root") == "" {
+			return errors.New("'http.files.root' should be set to enable the file server")
+		}
+		if !strings.HasPrefix(cfg.GetString("http.files.prefix"), "/") || !strings.HasSuffix(cfg.GetString("http.files.prefix"), "/") {
+			return errors.New("'http.files.prefix' should start and end with '/'")
+		}
+	}
+
+	if cfg.GetBool("http.health.enabled") && cfg.GetString("http.listen") == "" {
+		return errors.New("'http.listen' should be set to enable the health checks")
+	}
+
+	if cfg.GetBool("http.api.enabled") {
+		if cfg.GetString("http.listen") == "" {
+			return errors.New("'http.listen' should be set to enable the API")
+		}
+		if !strings.HasPrefix(cfg.GetString("http.api.prefix"), "/") || !strings.HasSuffix(cfg.GetString("http.api.prefix"), "/") {
+			return errors.New("'http.api.prefix' should start and end with '/'")
+		}
+		if cfg.GetString("http.api.token") == "" {
+			return errors.New("'http.api.token' should be set to enable the API")
+		}
+	}
+
+	if cfg.GetBool("http.metrics.enabled") {
+		if cfg.GetString("http.listen") == "" {
+			return errors.New("'http.listen' should be set to enable the metrics")
+		}
+		if !strings.HasPrefix(cfg.GetString("http.metrics.path"), "/") {
+			return errors.New("'http.metrics.path' should start with '/'")
+		}
+	}
+
 	if cfg.GetDuration("telegram.timeout") <= 0 {
 		return errors.New("'telegram.timeout' should be greater than 0")
 	}
 
+	for _, l := range []string{"user", "chat", "download"} {
+		if cfg.GetInt("limits."+l+".requests") > 0 && cfg.GetDuration("limits."+l+".period") <= 0 {
+			return fmt.Errorf("'limits.%s.period' should be greater than 0", l)
+		}
+	}
+
+	switch cfg.GetString("telegram.mode") {
+	case "polling":
+	case "webhook":
+		if err := validateWebhook(cfg); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown telegram mode '%s'", cfg.GetString("telegram.mode"))
+	}
+
+	return nil
+}
+
+func validateWebhook(cfg *viper.Viper) error {
+	for _, p := range []string{"telegram.webhook.url", "telegram.webhook.listen", "telegram.webhook.secret"} {
+		if cfg.GetString(p) == "" {
+			return fmt.Errorf(msgEmptyValue, p)
+		}
+	}
+
+	u, err := url.Parse(cfg.GetString("telegram.webhook.url"))
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return errors.New("'telegram.webhook.url' should be a valid HTTPS URL")
+	}
+	if !webhookSecretRegexp.MatchString(cfg.GetString("telegram.webhook.secret")) {
+		return errors.New("'telegram.webhook.secret' should be 1-256 characters of A-Z, a-z, 0-9, '_' and '-'")
+	}
+	if (cfg.GetString("telegram.webhook.cert") == "") != (cfg.GetString("telegram.webhook.key") == "") {
+		return errors.New("'telegram.webhook.cert' and 'telegram.webhook.key' should be set together")
+	}
+	if cfg.GetBool("telegram.webhook.self_signed") && cfg.GetString("telegram.webhook.cert") == "" {
+		return errors.New("'telegram.webhook.cert' should be set for the self-signed certificate")
+	}
 	return nil
 }
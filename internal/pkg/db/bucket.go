@@ -0,0 +1,96 @@
+package db
+
+import (
+	"fmt"
+	"sort"
+
+	log "github.com/sirupsen/logrus"
+	"go.etcd.io/bbolt"
+)
+
+// Bucket describes the named bucket of the DB
+type Bucket struct {
+	db   *DB
+	name []byte
+}
+
+// Keys returns a list of available keys in the bucket, sorted alphabetically
+func (b *Bucket) Keys() ([]string, error) {
+	var keys []string
+	log.WithField("bucket", string(b.name)).Debug("Getting the list of DB current keys")
+	err := b.db.b.View(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(b.name)
+		if bucket == nil {
+			return bbolt.ErrBucketNotFound
+		}
+		return bucket.ForEach(func(k, v []byte) error {
+			if v != nil {
+				keys = append(keys, string(k))
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to get the list of keys from bucket '%s': %w", b.name, err)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// Get acquires value from the bucket by provided key
+func (b *Bucket) Get(key string) ([]byte, error) {
+	var value []byte
+	log.WithField("bucket", string(b.name)).WithField("key", key).Debug("Getting value from DB")
+	err := b.db.b.View(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(b.name)
+		if bucket == nil {
+			return bbolt.ErrBucketNotFound
+		}
+		k, v := bucket.Cursor().Seek([]byte(key))
+		if k == nil || string(k) != key {
+			return ErrNotFound
+		} else if v == nil {
+			return ErrNilValue
+		}
+		value = make([]byte, len(v))
+		copy(value, v)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to get value for key '%s' from bucket '%s': %w", key, b.name, err)
+	}
+	log.WithField("bucket", string(b.name)).WithField("key", key).Debug("Got the value")
+	return value, nil
+}
+
+// Put sets/updates the value in the bucket by provided key
+func (b *Bucket) Put(key string, val []byte) error {
+	log.WithField("bucket", string(b.name)).WithField("key", key).Debug("Saving the value to DB")
+	err := b.db.b.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(b.name)
+		if bucket == nil {
+			return bbolt.ErrBucketNotFound
+		}
+		return bucket.Put([]byte(key), val)
+	})
+	if err != nil {
+		return fmt.Errorf("unable to put value for key '%s' to bucket '%s': %w", key, b.name, err)
+	}
+	return nil
+}
+
+// Delete removes the value from the bucket by provided key
+func (b *Bucket) Delete(key string) error {
+	log.WithField("bucket", string(b.name)).WithField("key", key).Debug("Deleting from DB")
+	err := b.db.b.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(b.name)
+		if bucket == nil {
+			return bbolt.ErrBucketNotFound
+		}
+		return bucket.Delete([]byte(key))
+	})
+	if err != nil {
+		return fmt.Errorf("unable to delete value for key '%s' from bucket '%s': %w", key, b.name, err)
+	}
+	return nil
+}
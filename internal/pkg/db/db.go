@@ -4,7 +4,6 @@ import (
 	"errors"
 	"fmt"
 	"os"
-	"sort"
 	"time"
 
 	log "github.com/sirupsen/logrus"
@@ -54,6 +53,46 @@ func NewDB(path string, timeout time.Duration) (*DB, error) {
 	return db, nil
 }
 
+// Ping checks that the DB answers a read transaction in time
+func (db *DB) Ping() error {
+	done := make(chan error, 1)
+	go func() {
+		done <- db.b.View(func(tx *bbolt.Tx) error {
+			if tx.Bucket(bucketName) == nil {
+				return bbolt.ErrBucketNotFound
+			}
+			return nil
+		})
+	}()
+
+	timeout := db.timeout
+	if timeout <= 0 {
+		timeout = time.Second
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			return fmt.Errorf("unable to read DB: %w", err)
+		}
+		return nil
+	case <-time.After(timeout):
+		return errors.New("DB read transaction timed out")
+	}
+}
+
+// Size returns the size of the DB data
+func (db *DB) Size() (int64, error) {
+	var size int64
+	err := db.b.View(func(tx *bbolt.Tx) error {
+		size = tx.Size()
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("unable to get DB size: %w", err)
+	}
+	return size, nil
+}
+
 // Close closes the DB
 func (db *DB) Close(delete bool) error {
 	log.Debug("Closing the DB")
@@ -80,85 +119,41 @@ func (db *DB) Close(delete bool) error {
 	}
 }
 
-// Keys returns a list of available keys in the global bucket, sorted alphabetically
-func (db *DB) Keys() ([]string, error) {
-	var keys []string
-	log.Debug("Getting the list of DB current keys")
-	err := db.b.View(func(tx *bbolt.Tx) error {
-		b := tx.Bucket(bucketName)
-		if b == nil {
-			return bbolt.ErrBucketNotFound
-		}
-		return b.ForEach(func(k, v []byte) error {
-			if v != nil {
-				keys = append(keys, string(k))
-			}
-			return nil
-		})
+// Bucket returns the named bucket of the DB, creating it if it doesn't exist yet
+func (db *DB) Bucket(name string) (*Bucket, error) {
+	log.WithField("bucket", name).Debug("Setting the bucket")
+	err := db.b.Update(func(tx *bbolt.Tx) error {
+		_, bErr := tx.CreateBucketIfNotExists([]byte(name))
+		return bErr
 	})
 	if err != nil {
-		return nil, fmt.Errorf("unable to get the list of keys from DB: %w", err)
+		return nil, fmt.Errorf("unable to create bucket '%s': %w", name, err)
 	}
-	sort.Strings(keys)
-	return keys, nil
+	return &Bucket{db: db, name: []byte(name)}, nil
+}
+
+// Keys returns a list of available keys in the global bucket, sorted alphabetically
+func (db *DB) Keys() ([]string, error) {
+	return db.global().Keys()
 }
 
 // Get acquires value from DB by provided key
 func (db *DB) Get(key string) ([]byte, error) {
-	var value []byte
-	log.WithField("key", key).Debug("Getting value from DB")
-	err := db.b.View(func(tx *bbolt.Tx) error {
-		b := tx.Bucket(bucketName)
-		if b == nil {
-			return bbolt.ErrBucketNotFound
-		}
-		k, v := b.Cursor().Seek([]byte(key))
-		if k == nil || string(k) != key {
-			return ErrNotFound
-		} else if v == nil {
-			return ErrNilValue
-		}
-		value = make([]byte, len(v))
-		copy(value, v)
-		return nil
-	})
-	if err != nil {
-		return nil, fmt.Errorf("unable to get value for key '%s' from DB: %w", key, err)
-	}
-	log.WithField("key", key).Debug("Got the value")
-	return value, nil
+	return db.global().Get(key)
 }
 
 // Put sets/updates the value in DB by provided bucket and key
 func (db *DB) Put(key string, val []byte) error {
-	log.WithField("key", key).Debug("Saving the value to DB")
-	err := db.b.Update(func(tx *bbolt.Tx) error {
-		b := tx.Bucket(bucketName)
-		if b == nil {
-			return bbolt.ErrBucketNotFound
-		}
-		return b.Put([]byte(key), val)
-	})
-	if err != nil {
-		return fmt.Errorf("unable to put value for key '%s' to DB: %w", key, err)
-	}
-	return nil
+	return db.global().Put(key, val)
 }
 
 // Delete removes the value from DB by provided bucket and key
 func (db *DB) Delete(key string) error {
-	log.WithField("key", key).Debug("Deleting from DB")
-	err := db.b.Update(func(tx *bbolt.Tx) error {
-		b := tx.Bucket(bucketName)
-		if b == nil {
-			return bbolt.ErrBucketNotFound
-		}
-		return b.Delete([]byte(key))
-	})
-	if err != nil {
-		return fmt.Errorf("unable to delete value for key '%s' from DB: %w", key, err)
-	}
-	return nil
+	return db.global().Delete(key)
+}
+
+func (db *DB) global() *Bucket {
+	return &Bucket{db: db, name: bucketName}
 }
 
 // Purge removes the bucket from DB
@@ -0,0 +1,141 @@
+package health
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Check returns the state details of the dependency, or an error if it's not OK
+type Check func() (string, error)
+
+// Health serves the liveness and readiness endpoints.
+// The liveness checks are included in the readiness ones.
+type Health struct {
+	ready bool
+	live  []namedCheck
+	all   []namedCheck
+	mtx   sync.RWMutex
+}
+
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+type result struct {
+	OK      bool   `json:"ok"`
+	Details string `json:"details,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+type response struct {
+	Status string            `json:"status"`
+	Checks map[string]result `json:"checks"`
+}
+
+// New creates a new Health instance, which is not ready until SetReady is called
+func New() *Health {
+	return &Health{}
+}
+
+// SetReady marks the startup as finished
+func (h *Health) SetReady() {
+	h.mtx.Lock()
+	h.ready = true
+	h.mtx.Unlock()
+}
+
+// Live registers the liveness check
+func (h *Health) Live(name string, check Check) {
+	h.mtx.Lock()
+	h.live = append(h.live, namedCheck{name: name, check: check})
+	h.all = append(h.all, namedCheck{name: name, check: check})
+	h.mtx.Unlock()
+}
+
+// Ready registers the readiness check
+func (h *Health) Ready(name string, check Check) {
+	h.mtx.Lock()
+	h.all = append(h.all, namedCheck{name: name, check: check})
+	h.mtx.Unlock()
+}
+
+// Healthz handles the liveness requests
+func (h *Health) Healthz(w http.ResponseWriter, _ *http.Request) {
+	h.mtx.RLock()
+	checks := h.live
+	h.mtx.RUnlock()
+
+	h.write(w, run(checks))
+}
+
+// Readyz handles the readiness requests
+func (h *Health) Readyz(w http.ResponseWriter, _ *http.Request) {
+	h.mtx.RLock()
+	checks, ready := h.all, h.ready
+	h.mtx.RUnlock()
+
+	resp := run(checks)
+	startup := result{OK: ready, Details: "finished"}
+	if !ready {
+		startup.Details = ""
+		startup.Error = "storages are not loaded yet"
+		resp.Status = statusFail
+	}
+	resp.Checks["startup"] = startup
+	h.write(w, resp)
+}
+
+const (
+	statusOK   = "ok"
+	statusFail = "fail"
+)
+
+func run(checks []namedCheck) response {
+	resp := response{Status: statusOK, Checks: make(map[string]result, len(checks)+1)}
+	for _, c := range checks {
+		details, err := c.check()
+		r := result{OK: err == nil, Details: details}
+		if err != nil {
+			r.Error = err.Error()
+			resp.Status = statusFail
+		}
+		resp.Checks[c.name] = r
+	}
+	return resp
+}
+
+func (h *Health) write(w http.ResponseWriter, resp response) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	if resp.Status != statusOK {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Errorf("Unable to write health response: %v", err)
+	}
+}
+
+// Heartbeat safely keeps the time of the last successful iteration of some loop
+type Heartbeat struct {
+	v atomic.Value
+}
+
+// Beat records the successful iteration
+func (hb *Heartbeat) Beat() {
+	hb.v.Store(time.Now())
+}
+
+// Age returns the time passed since the last beat, or false if there were none
+func (hb *Heartbeat) Age() (time.Duration, bool) {
+	t, ok := hb.v.Load().(time.Time)
+	if !ok {
+		return 0, false
+	}
+	return time.Since(t), true
+}
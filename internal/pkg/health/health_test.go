@@ -0,0 +1,82 @@
+package health
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHealth(t *testing.T) {
+	var (
+		liveErr  error
+		readyErr error
+	)
+	h := New()
+	h.Live("telegram", func() (string, error) { return "1s", liveErr })
+	h.Ready("db", func() (string, error) { return "", readyErr })
+
+	tests := []struct {
+		name     string
+		ready    bool
+		liveErr  error
+		readyErr error
+		// expected status codes of /healthz and /readyz
+		healthz, readyz int
+		// failed checks of /readyz
+		failed []string
+	}{
+		{"starting", false, nil, nil, http.StatusOK, http.StatusServiceUnavailable, []string{"startup"}},
+		{"ready", true, nil, nil, http.StatusOK, http.StatusOK, nil},
+		{"dependency failed", true, nil, errors.New("db is closed"), http.StatusOK, http.StatusServiceUnavailable, []string{"db"}},
+		{"stuck", true, errors.New("no poll"), nil, http.StatusServiceUnavailable, http.StatusServiceUnavailable, []string{"telegram"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			liveErr, readyErr = tt.liveErr, tt.readyErr
+			if tt.ready {
+				h.SetReady()
+			}
+
+			w := httptest.NewRecorder()
+			h.Healthz(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+			if w.Code != tt.healthz {
+				t.Errorf("/healthz = %d, want %d", w.Code, tt.healthz)
+			}
+
+			w = httptest.NewRecorder()
+			h.Readyz(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+			if w.Code != tt.readyz {
+				t.Errorf("/readyz = %d, want %d", w.Code, tt.readyz)
+			}
+			var resp response
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatalf("unable to decode /readyz response: %v", err)
+			}
+			if len(resp.Checks) != 3 {
+				t.Errorf("/readyz returned %d checks, want 3", len(resp.Checks))
+			}
+			var failed []string
+			for _, name := range []string{"db", "startup", "telegram"} {
+				if !resp.Checks[name].OK {
+					failed = append(failed, name)
+				}
+			}
+			if len(failed) != len(tt.failed) || len(failed) > 0 && failed[0] != tt.failed[0] {
+				t.Errorf("/readyz failed checks = %v, want %v", failed, tt.failed)
+			}
+		})
+	}
+}
+
+func TestHeartbeat(t *testing.T) {
+	var hb Heartbeat
+	if _, ok := hb.Age(); ok {
+		t.Error("Age() of the new heartbeat is known")
+	}
+	hb.Beat()
+	if age, ok := hb.Age(); !ok || age < 0 {
+		t.Errorf("Age() = %s, %t after the beat", age, ok)
+	}
+}
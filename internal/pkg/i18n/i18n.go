@@ -0,0 +1,217 @@
+package i18n
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+const (
+	catalogPrefix = "messages."
+	catalogExt    = ".toml"
+)
+
+var placeholderRegexp = regexp.MustCompile(`\{(\w+)\}`)
+
+var (
+	// positionalRegexp matches the positional fmt verbs like %s or %d, which aren't supported by the messages
+	positionalRegexp = regexp.MustCompile(`%[-+#0]*[0-9]*(\.[0-9]+)?[sdvqxXfgtTbcoeEU]`)
+	// escapedRegexp matches the URLs and the URL-encoded text, which may look like the verbs, e.g. %2f or %d0%bf
+	escapedRegexp = regexp.MustCompile(`https?://\S+|(%[0-9A-Fa-f]{2}){2,}`)
+)
+
+// Args describes the named placeholder values of the message
+type Args map[string]interface{}
+
+// Translator keeps the message catalogs of all the locales.
+// The default catalog is the 'messages' section of the config, the other ones are read
+// from the '<locale>.toml' files in the 'i18n.path' folder and fall back to the default one.
+type Translator struct {
+	def      string
+	catalogs map[string]*viper.Viper
+}
+
+// New creates a new Translator instance
+func New(cfg *viper.Viper) (*Translator, error) {
+	t := &Translator{
+		def:      Normalize(cfg.GetString("i18n.default")),
+		catalogs: make(map[string]*viper.Viper),
+	}
+	if err := validate(t.def, cfg); err != nil {
+		return nil, err
+	}
+	t.catalogs[t.def] = cfg
+
+	dir := cfg.GetString("i18n.path")
+	if dir == "" {
+		return t, nil
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read locales folder: %w", err)
+	}
+	for _, f := range files {
+		if f.IsDir() || filepath.Ext(f.Name()) != catalogExt {
+			continue
+		}
+		locale := Normalize(strings.TrimSuffix(f.Name(), catalogExt))
+		if locale == t.def {
+			log.Warnf("Locale file %s is ignored, the default locale is taken from the config", f.Name())
+			continue
+		}
+
+		catalog := viper.New()
+		catalog.SetConfigFile(filepath.Join(dir, f.Name()))
+		if err = catalog.ReadInConfig(); err != nil {
+			return nil, fmt.Errorf("unable to read locale %s: %w", locale, err)
+		}
+		if err = validate(locale, catalog); err != nil {
+			return nil, err
+		}
+		catalog.WatchConfig()
+		t.catalogs[locale] = catalog
+		log.WithField("locale", locale).Debug("Loaded the locale")
+	}
+	return t, nil
+}
+
+// validate checks that the messages of the catalog use the named placeholders only,
+// as the positional ones of the older configs would be shown to the users as is
+func validate(locale string, catalog *viper.Viper) error {
+	keys := catalog.AllKeys()
+	sort.Strings(keys)
+	for _, key := range keys {
+		if !strings.HasPrefix(key, catalogPrefix) {
+			continue
+		}
+		msg, ok := catalog.Get(key).(string)
+		if !ok {
+			continue
+		}
+		if verb := positionalRegexp.FindString(escapedRegexp.ReplaceAllString(msg, " ")); verb != "" {
+			return fmt.Errorf("message '%s' of locale %s uses the positional placeholder '%s', replace it with the named one like '{date}'",
+				strings.TrimPrefix(key, catalogPrefix), locale, verb)
+		}
+	}
+	return nil
+}
+
+// Default returns the default locale
+func (t *Translator) Default() string {
+	return t.def
+}
+
+// Locales returns the list of the available locales, sorted alphabetically
+func (t *Translator) Locales() []string {
+	result := make([]string, 0, len(t.catalogs))
+	for locale := range t.catalogs {
+		result = append(result, locale)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// Match returns the available locale for the language code, e.g. "pt" for "pt-BR" if there's no "pt-br" catalog
+func (t *Translator) Match(lang string) (string, bool) {
+	for _, locale := range chain(Normalize(lang)) {
+		if _, ok := t.catalogs[locale]; ok {
+			return locale, true
+		}
+	}
+	return "", false
+}
+
+// Localizer returns the Localizer for the locale, falling back to the default one if it's not available
+func (t *Translator) Localizer(locale string) *Localizer {
+	l := &Localizer{locale: t.def}
+	if matched, ok := t.Match(locale); ok {
+		l.locale = matched
+	}
+	for _, c := range chain(l.locale) {
+		if catalog, ok := t.catalogs[c]; ok && c != t.def {
+			l.catalogs = append(l.catalogs, catalog)
+		}
+	}
+	l.catalogs = append(l.catalogs, t.catalogs[t.def])
+	return l
+}
+
+// Localizer translates the messages into a single locale
+type Localizer struct {
+	locale   string
+	catalogs []*viper.Viper
+}
+
+// Locale returns the locale of the Localizer
+func (l *Localizer) Locale() string {
+	return l.locale
+}
+
+// T returns the message by key with the placeholders replaced by the args
+func (l *Localizer) T(key string, args Args) string {
+	return format(l.form(key, "other"), args)
+}
+
+// N returns the plural form of the message by key for the count with the placeholders replaced by the args.
+// The count is available to the message as the {count} placeholder.
+func (l *Localizer) N(key string, count int, args Args) string {
+	values := Args{"count": count}
+	for k, v := range args {
+		values[k] = v
+	}
+	return format(l.form(key, pluralForm(l.locale, count)), values)
+}
+
+// form looks up the message through the fallback chain: either a string, or a table of the plural forms
+func (l *Localizer) form(key, form string) string {
+	for _, catalog := range l.catalogs {
+		switch v := catalog.Get(catalogPrefix + key).(type) {
+		case string:
+			return v
+		case map[string]interface{}:
+			if s, ok := v[form].(string); ok {
+				return s
+			}
+			if s, ok := v["other"].(string); ok {
+				return s
+			}
+		}
+	}
+	log.WithField("locale", l.locale).Errorf("Message '%s' is missing", key)
+	return key
+}
+
+// Normalize returns the lowercase locale with '-' as the separator
+func Normalize(locale string) string {
+	return strings.ToLower(strings.Replace(strings.TrimSpace(locale), "_", "-", -1))
+}
+
+// chain returns the locale followed by its base language, e.g. "pt-br", "pt"
+func chain(locale string) []string {
+	if locale == "" {
+		return nil
+	}
+	result := []string{locale}
+	if i := strings.Index(locale, "-"); i > 0 {
+		result = append(result, locale[:i])
+	}
+	return result
+}
+
+func format(msg string, args Args) string {
+	if len(args) == 0 {
+		return msg
+	}
+	return placeholderRegexp.ReplaceAllStringFunc(msg, func(p string) string {
+		if v, ok := args[p[1:len(p)-1]]; ok {
+			return fmt.Sprint(v)
+		}
+		return p
+	})
+}
@@ -0,0 +1,33 @@
+package i18n
+
+import (
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  string
+		ok   bool
+	}{
+		{"named", "Release {date} is ready", true},
+		{"percent", "Downloaded 50% of the package", true},
+		{"url escapes", "See https://example.com/a%2Fb%20d/%2e and [wiki](https://github.com/opengapps/opengapps/wiki%2fHome)", true},
+		{"encoded text", "Поиск: %D0%BF%d1%80%d0%b8", true},
+		{"string", "Release %s is ready", false},
+		{"number", "Cancelled %d requests", false},
+		{"width", "Size: %10d bytes", false},
+		{"precision", "Done: %.2f%%", false},
+		{"flags", "Value %-5v", false},
+		{"next to url", "Got %s at https://example.com/%2f", false},
+	}
+	for _, tt := range tests {
+		catalog := viper.New()
+		catalog.Set("messages.test", tt.msg)
+		if err := validate("en", catalog); (err == nil) != tt.ok {
+			t.Errorf("%s: validate(%q) error = %v, want ok %t", tt.name, tt.msg, err, tt.ok)
+		}
+	}
+}
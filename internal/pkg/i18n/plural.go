@@ -0,0 +1,38 @@
+package i18n
+
+// pluralRules maps the languages with the catalogs to their rules, the rest use the English rule
+var pluralRules = map[string]func(n int) string{
+	"en": english,
+	"ru": russian,
+}
+
+// pluralForm returns the CLDR plural category of the integer count for the locale
+func pluralForm(locale string, n int) string {
+	if n < 0 {
+		n = -n
+	}
+	for _, l := range chain(locale) {
+		if rule, ok := pluralRules[l]; ok {
+			return rule(n)
+		}
+	}
+	return english(n)
+}
+
+func english(n int) string {
+	if n == 1 {
+		return "one"
+	}
+	return "other"
+}
+
+func russian(n int) string {
+	switch mod10, mod100 := n%10, n%100; {
+	case mod10 == 1 && mod100 != 11:
+		return "one"
+	case mod10 >= 2 && mod10 <= 4 && (mod100 < 12 || mod100 > 14):
+		return "few"
+	default:
+		return "many"
+	}
+}
@@ -0,0 +1,87 @@
+package i18n
+
+import (
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestPluralForm(t *testing.T) {
+	tests := []struct {
+		locale string
+		n      int
+		want   string
+	}{
+		{"en", 0, "other"},
+		{"en", 1, "one"},
+		{"en", 2, "other"},
+		{"en", 11, "other"},
+		{"en", 21, "other"},
+		{"en", -1, "one"},
+
+		{"ru", 0, "many"},
+		{"ru", 1, "one"},
+		{"ru", 2, "few"},
+		{"ru", 4, "few"},
+		{"ru", 5, "many"},
+		{"ru", 11, "many"},
+		{"ru", 12, "many"},
+		{"ru", 14, "many"},
+		{"ru", 21, "one"},
+		{"ru", 22, "few"},
+		{"ru", 25, "many"},
+		{"ru", 101, "one"},
+		{"ru", 111, "many"},
+		{"ru", 112, "many"},
+		{"ru", 122, "few"},
+		{"ru", -2, "few"},
+
+		// the regional locales use the rule of their base language
+		{"ru-ua", 3, "few"},
+		{"en-gb", 1, "one"},
+		// the languages without a rule use the English one
+		{"de", 1, "one"},
+		{"de", 3, "other"},
+		{"", 1, "one"},
+	}
+	for _, tt := range tests {
+		if got := pluralForm(tt.locale, tt.n); got != tt.want {
+			t.Errorf("pluralForm(%q, %d) = %s, want %s", tt.locale, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestLocalizerN(t *testing.T) {
+	en := viper.New()
+	en.Set("messages.cancel.ok", map[string]interface{}{
+		"one":   "Cancelled {count} request.",
+		"other": "Cancelled {count} requests.",
+	})
+	ru := viper.New()
+	ru.Set("messages.cancel.ok", map[string]interface{}{
+		"one":  "Отменён {count} запрос.",
+		"few":  "Отменено {count} запроса.",
+		"many": "Отменено {count} запросов.",
+	})
+	tr := &Translator{def: "en", catalogs: map[string]*viper.Viper{"en": en, "ru": ru}}
+
+	tests := []struct {
+		locale string
+		n      int
+		want   string
+	}{
+		{"en", 1, "Cancelled 1 request."},
+		{"en", 3, "Cancelled 3 requests."},
+		{"ru", 1, "Отменён 1 запрос."},
+		{"ru", 3, "Отменено 3 запроса."},
+		{"ru", 5, "Отменено 5 запросов."},
+		{"ru-ru", 21, "Отменён 21 запрос."},
+		// the unknown locales fall back to the default one
+		{"de", 2, "Cancelled 2 requests."},
+	}
+	for _, tt := range tests {
+		if got := tr.Localizer(tt.locale).N("cancel.ok", tt.n, nil); got != tt.want {
+			t.Errorf("N(%q, %d) = %q, want %q", tt.locale, tt.n, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package i18n
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/nezorflame/opengapps-mirror-bot/internal/pkg/db"
+)
+
+const bucketName = "locales"
+
+// Store stores the locales chosen by the users in the DB
+type Store struct {
+	bucket *db.Bucket
+}
+
+// NewStore creates a new Store instance
+func NewStore(cache *db.DB) (*Store, error) {
+	bucket, err := cache.Bucket(bucketName)
+	if err != nil {
+		return nil, fmt.Errorf("unable to init locales bucket: %w", err)
+	}
+	return &Store{bucket: bucket}, nil
+}
+
+// Get returns the locale chosen by the user, or an empty string if there's none
+func (s *Store) Get(userID int) (string, error) {
+	body, err := s.bucket.Get(strconv.Itoa(userID))
+	switch {
+	case err == nil:
+		return string(body), nil
+	case errors.Is(err, db.ErrNotFound):
+		return "", nil
+	default:
+		return "", fmt.Errorf("unable to get locale: %w", err)
+	}
+}
+
+// Set saves the locale chosen by the user
+func (s *Store) Set(userID int, locale string) error {
+	if err := s.bucket.Put(strconv.Itoa(userID), []byte(locale)); err != nil {
+		return fmt.Errorf("unable to save locale: %w", err)
+	}
+	return nil
+}
+
+// Reset removes the locale chosen by the user
+func (s *Store) Reset(userID int) error {
+	if err := s.bucket.Delete(strconv.Itoa(userID)); err != nil {
+		return fmt.Errorf("unable to delete locale: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+package jobs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/nezorflame/opengapps-mirror-bot/internal/pkg/db"
+	"github.com/nezorflame/opengapps-mirror-bot/internal/pkg/storage"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	bucketName   = "jobs"
+	keySeparator = ":"
+)
+
+// State describes the state of the mirror job
+type State string
+
+// State consts
+const (
+	StatePending State = "pending"
+	StateRunning State = "running"
+)
+
+// Request describes the user waiting for the job result
+type Request struct {
+	ChatID          int64  `json:"chat_id,omitempty"`
+	MessageID       int    `json:"message_id,omitempty"`
+	StatusID        int    `json:"status_id,omitempty"`
+	InlineMessageID string `json:"inline_message_id,omitempty"`
+	Locale          string `json:"locale,omitempty"`
+}
+
+// Job describes the mirror job of the package
+type Job struct {
+	Date string `json:"date"`
+	storage.PackageKey
+	State     State     `json:"state"`
+	Requests  []Request `json:"requests"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Key returns the DB key for the job
+func (j *Job) Key() string {
+	return j.Date + keySeparator + j.PackageKey.String()
+}
+
+// Store stores the unfinished mirror jobs in the DB
+type Store struct {
+	bucket *db.Bucket
+	mtx    sync.Mutex
+}
+
+// NewStore creates a new Store instance
+func NewStore(cache *db.DB) (*Store, error) {
+	bucket, err := cache.Bucket(bucketName)
+	if err != nil {
+		return nil, fmt.Errorf("unable to init jobs bucket: %w", err)
+	}
+	return &Store{bucket: bucket}, nil
+}
+
+// Add records the request for the package mirror, creating the job if needed.
+// The job is marked as running, the already recorded request is not duplicated.
+func (s *Store) Add(date string, key storage.PackageKey, req Request) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	j := &Job{Date: date, PackageKey: key}
+	if err := s.get(j); err != nil {
+		if !errors.Is(err, db.ErrNotFound) {
+			return err
+		}
+		j.CreatedAt = time.Now()
+	}
+	j.State = StateRunning
+	for _, r := range j.Requests {
+		if r == req {
+			return s.put(j)
+		}
+	}
+	j.Requests = append(j.Requests, req)
+	return s.put(j)
+}
+
+// Done removes the request from the job, deleting the job once there are no requests left
+func (s *Store) Done(date string, key storage.PackageKey, req Request) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	j := &Job{Date: date, PackageKey: key}
+	if err := s.get(j); err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	requests := j.Requests[:0]
+	for _, r := range j.Requests {
+		if r != req {
+			requests = append(requests, r)
+		}
+	}
+	j.Requests = requests
+
+	if len(j.Requests) > 0 {
+		return s.put(j)
+	}
+	if err := s.bucket.Delete(j.Key()); err != nil {
+		return fmt.Errorf("unable to delete job '%s': %w", j.Key(), err)
+	}
+	return nil
+}
+
+// Reset marks all the jobs as pending and returns them.
+// It's used on startup to replay the jobs left unfinished by the previous run.
+func (s *Store) Reset() ([]*Job, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	keys, err := s.bucket.Keys()
+	if err != nil {
+		return nil, fmt.Errorf("unable to get jobs: %w", err)
+	}
+
+	result := make([]*Job, 0, len(keys))
+	for _, k := range keys {
+		body, err := s.bucket.Get(k)
+		if err != nil {
+			log.Warnf("Unable to get job '%s': %v", k, err)
+			continue
+		}
+
+		j := &Job{}
+		if err = json.Unmarshal(body, j); err != nil {
+			log.Warnf("Unable to unmarshal job '%s': %v", k, err)
+			continue
+		}
+
+		j.State = StatePending
+		if err = s.put(j); err != nil {
+			return nil, err
+		}
+		result = append(result, j)
+	}
+	return result, nil
+}
+
+func (s *Store) get(j *Job) error {
+	body, err := s.bucket.Get(j.Key())
+	if err != nil {
+		return fmt.Errorf("unable to get job '%s': %w", j.Key(), err)
+	}
+	if err = json.Unmarshal(body, j); err != nil {
+		return fmt.Errorf("unable to unmarshal job '%s': %w", j.Key(), err)
+	}
+	return nil
+}
+
+func (s *Store) put(j *Job) error {
+	j.UpdatedAt = time.Now()
+	body, err := json.Marshal(j)
+	if err != nil {
+		return fmt.Errorf("unable to marshal job '%s': %w", j.Key(), err)
+	}
+	if err = s.bucket.Put(j.Key(), body); err != nil {
+		return fmt.Errorf("unable to save job '%s': %w", j.Key(), err)
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package jobs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nezorflame/opengapps-mirror-bot/internal/pkg/db"
+	"github.com/nezorflame/opengapps-mirror-bot/internal/pkg/storage"
+	"github.com/nezorflame/opengapps-mirror-bot/pkg/gapps"
+)
+
+func TestStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jobs-test")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	cache, err := db.NewDB(filepath.Join(dir, "bolt.db"), time.Second)
+	if err != nil {
+		t.Fatalf("unable to open DB: %v", err)
+	}
+	defer cache.Close(false)
+	s, err := NewStore(cache)
+	if err != nil {
+		t.Fatalf("unable to init store: %v", err)
+	}
+
+	var (
+		key    = storage.PackageKey{Platform: gapps.PlatformArm64, Android: gapps.Android100, Variant: gapps.VariantNano}
+		first  = Request{ChatID: 1, MessageID: 10, Locale: "en"}
+		second = Request{InlineMessageID: "inline", Locale: "ru"}
+	)
+	for _, req := range []Request{first, second, first} {
+		if err = s.Add("20200101", key, req); err != nil {
+			t.Fatalf("Add() returned error: %v", err)
+		}
+	}
+
+	jobs, err := s.Reset()
+	if err != nil {
+		t.Fatalf("Reset() returned error: %v", err)
+	}
+	if len(jobs) != 1 {
+		t.Fatalf("Reset() returned %d jobs, want 1", len(jobs))
+	}
+	j := jobs[0]
+	if j.Date != "20200101" || j.PackageKey != key || j.State != StatePending {
+		t.Errorf("Reset() job = %s %s %s, want 20200101 %s %s", j.Date, j.PackageKey, j.State, key, StatePending)
+	}
+	if len(j.Requests) != 2 || j.Requests[0] != first || j.Requests[1] != second {
+		t.Errorf("job requests = %+v, want the deduplicated %+v and %+v", j.Requests, first, second)
+	}
+
+	// the job is kept until all of its requests are done
+	if err = s.Done("20200101", key, first); err != nil {
+		t.Fatalf("Done() returned error: %v", err)
+	}
+	if jobs, _ = s.Reset(); len(jobs) != 1 || len(jobs[0].Requests) != 1 {
+		t.Fatalf("jobs after the first request is done = %+v, want one with one request", jobs)
+	}
+	if err = s.Done("20200101", key, second); err != nil {
+		t.Fatalf("Done() returned error: %v", err)
+	}
+	if jobs, _ = s.Reset(); len(jobs) != 0 {
+		t.Errorf("jobs after all requests are done = %+v, want none", jobs)
+	}
+	// the unknown job is done already
+	if err = s.Done("20200102", key, first); err != nil {
+		t.Errorf("Done() of the unknown job returned error: %v", err)
+	}
+}
@@ -0,0 +1,111 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "opengapps_mirror_bot"
+
+// Bot metrics
+var (
+	Commands = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "commands_total",
+		Help:      "Number of the handled bot commands and updates by type.",
+	}, []string{"command"})
+
+	ParseErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "parse_errors_total",
+		Help:      "Number of the command parsing errors by class.",
+	}, []string{"class"})
+
+	Throttled = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "throttled_total",
+		Help:      "Number of the requests throttled by the rate limits by limit (user, chat or download).",
+	}, []string{"limit"})
+)
+
+// Download metrics
+var (
+	QueueTokens = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "download_queue_tokens",
+		Help:      "Number of the download queue tokens in use.",
+	})
+
+	QueueCapacity = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "download_queue_capacity",
+		Help:      "Maximum number of the download queue tokens.",
+	})
+
+	QueueWait = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "download_queue_wait_seconds",
+		Help:      "Time spent waiting for the download queue token.",
+		Buckets:   prometheus.ExponentialBuckets(0.01, 4, 10),
+	})
+
+	DownloadBytes = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "download_bytes_total",
+		Help:      "Number of the downloaded bytes.",
+	})
+
+	DownloadDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "download_duration_seconds",
+		Help:      "Duration of the downloads by mode (single or multi) and result.",
+		Buckets:   prometheus.ExponentialBuckets(0.5, 2, 14),
+	}, []string{"mode", "result"})
+
+	MD5Mismatches = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "md5_mismatches_total",
+		Help:      "Number of the downloaded files with MD5 checksum mismatch.",
+	})
+)
+
+// Mirror metrics
+var Uploads = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "uploads_total",
+	Help:      "Number of the mirror uploads by target and result.",
+}, []string{"target", "result"})
+
+// Github metrics
+var (
+	GithubRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "github_requests_total",
+		Help:      "Number of the Github API requests by method and result.",
+	}, []string{"method", "result"})
+
+	GithubRateRemaining = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "github_rate_limit_remaining",
+		Help:      "Number of the Github API requests remaining in the current rate limit window.",
+	})
+)
+
+// Result label values
+const (
+	ResultOK    = "ok"
+	ResultError = "error"
+)
+
+// Result returns the result label value for the error
+func Result(err error) string {
+	if err != nil {
+		return ResultError
+	}
+	return ResultOK
+}
+
+// RegisterGauge registers the gauge which value is provided by fn on every scrape
+func RegisterGauge(name, help string, fn func() float64) {
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{Namespace: namespace, Name: name, Help: help}, fn)
+}
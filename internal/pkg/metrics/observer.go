@@ -0,0 +1,55 @@
+package metrics
+
+import "time"
+
+// Downloads records the metrics of the download queue, it's the net.Observer
+type Downloads struct{}
+
+// QueueCapacity sets the queue capacity
+func (Downloads) QueueCapacity(n int) {
+	QueueCapacity.Set(float64(n))
+}
+
+// Acquired records the token taken after the wait
+func (Downloads) Acquired(wait time.Duration) {
+	QueueWait.Observe(wait.Seconds())
+	QueueTokens.Inc()
+}
+
+// Released records the token returned
+func (Downloads) Released() {
+	QueueTokens.Dec()
+}
+
+// Downloaded records the received bytes
+func (Downloads) Downloaded(n int) {
+	DownloadBytes.Add(float64(n))
+}
+
+// Finished records the download duration by mode and result
+func (Downloads) Finished(mode string, d time.Duration, err error) {
+	DownloadDuration.WithLabelValues(mode, Result(err)).Observe(d.Seconds())
+}
+
+// ChecksumMismatch records the file with the wrong checksum
+func (Downloads) ChecksumMismatch() {
+	MD5Mismatches.Inc()
+}
+
+// Bot records the metrics of the bot, it's the telegram.Observer
+type Bot struct{}
+
+// Command records the handled command or update
+func (Bot) Command(name string) {
+	Commands.WithLabelValues(name).Inc()
+}
+
+// ParseError records the command parsing error
+func (Bot) ParseError(class string) {
+	ParseErrors.WithLabelValues(class).Inc()
+}
+
+// Throttled records the request throttled by the limit
+func (Bot) Throttled(limit string) {
+	Throttled.WithLabelValues(limit).Inc()
+}
@@ -0,0 +1,81 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Limiter limits the request rate per key with the token buckets:
+// every key can make up to N requests at once, and gets N more per period
+type Limiter struct {
+	burst   float64
+	rate    float64 // tokens per second
+	period  time.Duration
+	buckets map[int64]*bucket
+	swept   time.Time
+	mtx     sync.Mutex
+}
+
+type bucket struct {
+	tokens    float64
+	last      time.Time
+	throttled int
+}
+
+// New creates a new Limiter for N requests per period.
+// It returns nil if the limit is disabled, which is a valid Limiter allowing every request.
+func New(requests int, period time.Duration) *Limiter {
+	if requests <= 0 || period <= 0 {
+		return nil
+	}
+	return &Limiter{
+		burst:   float64(requests),
+		rate:    float64(requests) / period.Seconds(),
+		period:  period,
+		buckets: make(map[int64]*bucket),
+		swept:   time.Now(),
+	}
+}
+
+// Allow takes a token from the bucket of the key. If there are none left, it returns the time
+// until the next token and the number of the consecutive throttled requests of the key.
+func (l *Limiter) Allow(key int64) (time.Duration, int) {
+	if l == nil {
+		return 0, 0
+	}
+
+	now := time.Now()
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		b.throttled = 0
+		return 0, 0
+	}
+	b.throttled++
+	return time.Duration((1 - b.tokens) / l.rate * float64(time.Second)), b.throttled
+}
+
+// sweep removes the buckets which are refilled completely, once per period
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.swept) < l.period {
+		return
+	}
+	for k, b := range l.buckets {
+		if now.Sub(b.last) >= l.period {
+			delete(l.buckets, k)
+		}
+	}
+	l.swept = now
+}
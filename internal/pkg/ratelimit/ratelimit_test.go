@@ -0,0 +1,128 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNewDisabled(t *testing.T) {
+	tests := []struct {
+		requests int
+		period   time.Duration
+	}{
+		{0, time.Minute},
+		{-1, time.Minute},
+		{5, 0},
+		{5, -time.Minute},
+	}
+	for _, tt := range tests {
+		l := New(tt.requests, tt.period)
+		if l != nil {
+			t.Errorf("New(%d, %s) = %+v, want nil", tt.requests, tt.period, l)
+		}
+		for i := 0; i < 10; i++ {
+			if wait, throttled := l.Allow(1); wait != 0 || throttled != 0 {
+				t.Fatalf("disabled limiter Allow() = %s, %d, want 0, 0", wait, throttled)
+			}
+		}
+	}
+}
+
+func TestAllow(t *testing.T) {
+	tests := []struct {
+		name     string
+		requests int
+		period   time.Duration
+		calls    int
+		// allowed is the number of the calls allowed in a row
+		allowed int
+	}{
+		{"single", 1, time.Hour, 3, 1},
+		{"burst", 5, time.Hour, 8, 5},
+		{"under limit", 5, time.Hour, 4, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := New(tt.requests, tt.period)
+			step := tt.period / time.Duration(tt.requests)
+			for i := 0; i < tt.calls; i++ {
+				wait, throttled := l.Allow(1)
+				if i < tt.allowed {
+					if wait != 0 || throttled != 0 {
+						t.Fatalf("call %d = %s, %d, want allowed", i, wait, throttled)
+					}
+					continue
+				}
+				if want := i - tt.allowed + 1; throttled != want {
+					t.Errorf("call %d throttled = %d, want %d", i, throttled, want)
+				}
+				// the wait is the time until the next token, slightly less as the time has passed since the start
+				if wait <= 0 || wait > step {
+					t.Errorf("call %d wait = %s, want in (0, %s]", i, wait, step)
+				}
+			}
+		})
+	}
+}
+
+func TestAllowKeys(t *testing.T) {
+	l := New(1, time.Hour)
+	if wait, _ := l.Allow(1); wait != 0 {
+		t.Fatalf("first call of key 1 is throttled for %s", wait)
+	}
+	if wait, _ := l.Allow(2); wait != 0 {
+		t.Errorf("first call of key 2 is throttled for %s", wait)
+	}
+	if wait, _ := l.Allow(1); wait == 0 {
+		t.Error("second call of key 1 is allowed")
+	}
+}
+
+func TestAllowRefill(t *testing.T) {
+	tests := []struct {
+		name    string
+		elapsed time.Duration
+		// allowed is the number of the calls allowed after the elapsed time
+		allowed int
+	}{
+		{"none", 0, 0},
+		{"one token", 6 * time.Minute, 1},
+		{"partial tokens", 15 * time.Minute, 2},
+		{"full bucket", time.Hour, 10},
+		{"never over burst", 10 * time.Hour, 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := New(10, time.Hour)
+			for i := 0; i < 10; i++ {
+				l.Allow(1)
+			}
+			l.buckets[1].last = l.buckets[1].last.Add(-tt.elapsed)
+
+			for i := 0; i < tt.allowed; i++ {
+				if wait, throttled := l.Allow(1); wait != 0 || throttled != 0 {
+					t.Fatalf("call %d = %s, %d, want allowed", i, wait, throttled)
+				}
+			}
+			if wait, throttled := l.Allow(1); wait == 0 || throttled != 1 {
+				t.Errorf("call %d = %s, %d, want throttled once", tt.allowed, wait, throttled)
+			}
+		})
+	}
+}
+
+func TestSweep(t *testing.T) {
+	l := New(1, time.Minute)
+	l.Allow(1)
+	l.Allow(2)
+	l.buckets[1].last = l.buckets[1].last.Add(-time.Minute)
+	l.swept = l.swept.Add(-time.Minute)
+
+	l.Allow(3)
+	if _, ok := l.buckets[1]; ok {
+		t.Error("refilled bucket of key 1 isn't swept")
+	}
+	if _, ok := l.buckets[2]; !ok {
+		t.Error("bucket of key 2 is swept before it's refilled")
+	}
+}
@@ -0,0 +1,46 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Server is the embedded HTTP server for the bot endpoints
+type Server struct {
+	srv *http.Server
+	mux *http.ServeMux
+}
+
+// New creates a new Server instance listening on the address
+func New(addr string) *Server {
+	mux := http.NewServeMux()
+	return &Server{srv: &http.Server{Addr: addr, Handler: mux}, mux: mux}
+}
+
+// Handle registers the handler for the pattern
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	log.WithField("pattern", pattern).Debug("Registering HTTP handler")
+	s.mux.Handle(pattern, handler)
+}
+
+// Start starts to serve the requests in background
+func (s *Server) Start() {
+	go func() {
+		log.Infof("Starting HTTP server on %s", s.srv.Addr)
+		if err := s.srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Errorf("HTTP server has stopped: %v", err)
+		}
+	}()
+}
+
+// Stop gracefully shuts the server down
+func (s *Server) Stop(ctx context.Context) error {
+	if err := s.srv.Shutdown(ctx); err != nil {
+		return fmt.Errorf("unable to shut down HTTP server: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package stats
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/nezorflame/opengapps-mirror-bot/internal/pkg/db"
+	"github.com/nezorflame/opengapps-mirror-bot/internal/pkg/storage"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const bucketName = "stats"
+
+// Entry describes the request count for the package
+type Entry struct {
+	storage.PackageKey
+	Count int `json:"count"`
+}
+
+// Store stores the package request stats in the DB
+type Store struct {
+	bucket *db.Bucket
+	mtx    sync.Mutex
+}
+
+// NewStore creates a new Store instance
+func NewStore(cache *db.DB) (*Store, error) {
+	bucket, err := cache.Bucket(bucketName)
+	if err != nil {
+		return nil, fmt.Errorf("unable to init stats bucket: %w", err)
+	}
+	return &Store{bucket: bucket}, nil
+}
+
+// Inc increments the request count for the package
+func (s *Store) Inc(key storage.PackageKey) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	e := &Entry{PackageKey: key}
+	body, err := s.bucket.Get(key.String())
+	switch {
+	case err == nil:
+		if err = json.Unmarshal(body, e); err != nil {
+			return fmt.Errorf("unable to unmarshal stats for '%s': %w", key, err)
+		}
+	case !errors.Is(err, db.ErrNotFound):
+		return fmt.Errorf("unable to get stats for '%s': %w", key, err)
+	}
+
+	e.Count++
+	if body, err = json.Marshal(e); err != nil {
+		return fmt.Errorf("unable to marshal stats for '%s': %w", key, err)
+	}
+	if err = s.bucket.Put(key.String(), body); err != nil {
+		return fmt.Errorf("unable to save stats for '%s': %w", key, err)
+	}
+	return nil
+}
+
+// List returns all the stats entries, most requested first
+func (s *Store) List() ([]*Entry, error) {
+	keys, err := s.bucket.Keys()
+	if err != nil {
+		return nil, fmt.Errorf("unable to get stats: %w", err)
+	}
+
+	result := make([]*Entry, 0, len(keys))
+	for _, k := range keys {
+		body, err := s.bucket.Get(k)
+		if err != nil {
+			log.Warnf("Unable to get stats for '%s': %v", k, err)
+			continue
+		}
+
+		e := &Entry{}
+		if err = json.Unmarshal(body, e); err != nil {
+			log.Warnf("Unable to unmarshal stats for '%s': %v", k, err)
+			continue
+		}
+		result = append(result, e)
+	}
+
+	sort.SliceStable(result, func(i, j int) bool { return result[i].Count > result[j].Count })
+	return result, nil
+}
+
+// Top returns the keys of N most requested packages
+func (s *Store) Top(n int) ([]storage.PackageKey, error) {
+	entries, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+	if n < len(entries) {
+		entries = entries[:n]
+	}
+
+	result := make([]storage.PackageKey, len(entries))
+	for i := range entries {
+		result[i] = entries[i].PackageKey
+	}
+	return result, nil
+}
@@ -0,0 +1,72 @@
+package storage
+
+import "github.com/nezorflame/opengapps-mirror-bot/pkg/gapps"
+
+// ChangeKind describes how the package has changed between two releases
+type ChangeKind string
+
+// ChangeKind consts
+const (
+	ChangeAdded   ChangeKind = "added"
+	ChangeRemoved ChangeKind = "removed"
+	ChangeUpdated ChangeKind = "updated"
+)
+
+// Change describes the difference of a single package between two storages
+type Change struct {
+	PackageKey
+	Kind ChangeKind `json:"kind"`
+	// Old is nil for the added packages, New is nil for the removed ones
+	Old *Package `json:"old,omitempty"`
+	New *Package `json:"new,omitempty"`
+}
+
+// SizeDelta returns the difference between the new and the old package sizes
+func (c *Change) SizeDelta() int {
+	if c.Old == nil || c.New == nil {
+		return 0
+	}
+	return c.New.Size - c.Old.Size
+}
+
+// ChecksumChanged checks if the package checksums differ, comparing only the ones known for both packages
+func (c *Change) ChecksumChanged() bool {
+	if c.Old == nil || c.New == nil {
+		return false
+	}
+	o, n := c.Old.Checksums(), c.New.Checksums()
+	return o.MD5 != n.MD5 ||
+		o.SHA1 != "" && n.SHA1 != "" && o.SHA1 != n.SHA1 ||
+		o.SHA256 != "" && n.SHA256 != "" && o.SHA256 != n.SHA256
+}
+
+// Diff compares the packages of the storages: the ones added in b, the ones removed from a,
+// and the ones present in both with a different size or checksum.
+// The changes are ordered by platform, Android version and variant.
+func Diff(a, b *Storage) []*Change {
+	var result []*Change
+	for _, p := range gapps.PlatformValues() {
+		for _, av := range gapps.AndroidValues() {
+			for _, v := range gapps.VariantValues() {
+				o, okOld := a.Get(p, av, v)
+				n, okNew := b.Get(p, av, v)
+				c := &Change{PackageKey: PackageKey{Platform: p, Android: av, Variant: v}, Old: o, New: n}
+				switch {
+				case okOld && okNew:
+					if c.SizeDelta() == 0 && !c.ChecksumChanged() {
+						continue
+					}
+					c.Kind = ChangeUpdated
+				case okNew:
+					c.Kind = ChangeAdded
+				case okOld:
+					c.Kind = ChangeRemoved
+				default:
+					continue
+				}
+				result = append(result, c)
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,146 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/nezorflame/opengapps-mirror-bot/pkg/gapps"
+)
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b []*Package
+		want []ChangeKind
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name: "same",
+			a:    []*Package{testPackage(gapps.PlatformArm64, gapps.VariantNano, 100, "md5", "")},
+			b:    []*Package{testPackage(gapps.PlatformArm64, gapps.VariantNano, 100, "md5", "")},
+		},
+		{
+			name: "added",
+			b:    []*Package{testPackage(gapps.PlatformArm64, gapps.VariantNano, 100, "md5", "")},
+			want: []ChangeKind{ChangeAdded},
+		},
+		{
+			name: "removed",
+			a:    []*Package{testPackage(gapps.PlatformArm64, gapps.VariantNano, 100, "md5", "")},
+			want: []ChangeKind{ChangeRemoved},
+		},
+		{
+			name: "size changed",
+			a:    []*Package{testPackage(gapps.PlatformArm64, gapps.VariantNano, 100, "md5", "")},
+			b:    []*Package{testPackage(gapps.PlatformArm64, gapps.VariantNano, 120, "md5", "")},
+			want: []ChangeKind{ChangeUpdated},
+		},
+		{
+			name: "md5 changed",
+			a:    []*Package{testPackage(gapps.PlatformArm64, gapps.VariantNano, 100, "md5", "")},
+			b:    []*Package{testPackage(gapps.PlatformArm64, gapps.VariantNano, 100, "md5new", "")},
+			want: []ChangeKind{ChangeUpdated},
+		},
+		{
+			name: "sha256 changed",
+			a:    []*Package{testPackage(gapps.PlatformArm64, gapps.VariantNano, 100, "md5", "sha256")},
+			b:    []*Package{testPackage(gapps.PlatformArm64, gapps.VariantNano, 100, "md5", "sha256new")},
+			want: []ChangeKind{ChangeUpdated},
+		},
+		{
+			name: "sha256 known for one package only",
+			a:    []*Package{testPackage(gapps.PlatformArm64, gapps.VariantNano, 100, "md5", "")},
+			b:    []*Package{testPackage(gapps.PlatformArm64, gapps.VariantNano, 100, "md5", "sha256")},
+		},
+		{
+			name: "ordered by platform and variant",
+			a: []*Package{
+				testPackage(gapps.PlatformX86, gapps.VariantNano, 100, "md5", ""),
+				testPackage(gapps.PlatformArm64, gapps.VariantPico, 100, "md5", ""),
+				testPackage(gapps.PlatformArm, gapps.VariantNano, 100, "md5", ""),
+			},
+			b: []*Package{
+				testPackage(gapps.PlatformArm64, gapps.VariantNano, 100, "md5", ""),
+				testPackage(gapps.PlatformArm64, gapps.VariantPico, 100, "md5new", ""),
+				testPackage(gapps.PlatformArm, gapps.VariantNano, 100, "md5", ""),
+			},
+			want: []ChangeKind{ChangeUpdated, ChangeAdded, ChangeRemoved},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changes := Diff(testStorage(tt.a), testStorage(tt.b))
+			if len(changes) != len(tt.want) {
+				t.Fatalf("Diff() returned %d changes, want %d", len(changes), len(tt.want))
+			}
+			for i, c := range changes {
+				if c.Kind != tt.want[i] {
+					t.Errorf("change %d of %s = %s, want %s", i, c.PackageKey, c.Kind, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestDiffOrder(t *testing.T) {
+	b := []*Package{
+		testPackage(gapps.PlatformX86, gapps.VariantNano, 100, "md5", ""),
+		testPackage(gapps.PlatformArm64, gapps.VariantPico, 100, "md5", ""),
+		testPackage(gapps.PlatformArm64, gapps.VariantNano, 100, "md5", ""),
+	}
+	want := []PackageKey{
+		{Platform: gapps.PlatformArm64, Android: gapps.Android100, Variant: gapps.VariantPico},
+		{Platform: gapps.PlatformArm64, Android: gapps.Android100, Variant: gapps.VariantNano},
+		{Platform: gapps.PlatformX86, Android: gapps.Android100, Variant: gapps.VariantNano},
+	}
+
+	changes := Diff(testStorage(nil), testStorage(b))
+	if len(changes) != len(want) {
+		t.Fatalf("Diff() returned %d changes, want %d", len(changes), len(want))
+	}
+	for i, c := range changes {
+		if c.PackageKey != want[i] {
+			t.Errorf("change %d = %s, want %s", i, c.PackageKey, want[i])
+		}
+	}
+}
+
+func TestChangeSizeDelta(t *testing.T) {
+	tests := []struct {
+		name string
+		c    Change
+		want int
+	}{
+		{"grown", Change{Old: &Package{Size: 100}, New: &Package{Size: 150}}, 50},
+		{"shrunk", Change{Old: &Package{Size: 150}, New: &Package{Size: 100}}, -50},
+		{"added", Change{New: &Package{Size: 100}}, 0},
+		{"removed", Change{Old: &Package{Size: 100}}, 0},
+	}
+	for _, tt := range tests {
+		if got := tt.c.SizeDelta(); got != tt.want {
+			t.Errorf("%s: SizeDelta() = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func testPackage(p gapps.Platform, v gapps.Variant, size int, md5, sha256 string) *Package {
+	return &Package{
+		Name:     "open_gapps-" + p.String() + "-10.0-" + v.String() + "-20200101.zip",
+		Date:     "20200101",
+		MD5:      md5,
+		SHA256:   sha256,
+		Size:     size,
+		Platform: p,
+		Android:  gapps.Android100,
+		Variant:  v,
+	}
+}
+
+func testStorage(packages []*Package) *Storage {
+	s := &Storage{Packages: make(map[gapps.Platform]map[gapps.Android]map[gapps.Variant]*Package)}
+	for _, p := range packages {
+		s.Add(p)
+	}
+	return s
+}
@@ -3,17 +3,30 @@ package storage
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"sort"
+	"strings"
 	"sync"
 
 	"github.com/nezorflame/opengapps-mirror-bot/internal/pkg/db"
 	"github.com/nezorflame/opengapps-mirror-bot/pkg/net"
+	"github.com/nezorflame/opengapps-mirror-bot/pkg/upload"
 
 	"github.com/google/go-github/v37/github"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
 )
 
+// Expiry policies
+const (
+	ExpiryPolicyHide     = "hide"
+	ExpiryPolicyReupload = "reupload"
+)
+
+// ErrStorageNotFound is returned for the unknown release dates
+var ErrStorageNotFound = errors.New("storage not found")
+
 // GlobalStorage stores all the available storages
 type GlobalStorage struct {
 	storages map[string]*Storage
@@ -29,11 +42,12 @@ func NewGlobalStorage(cache *db.DB) *GlobalStorage {
 	}
 }
 
-// AddLatestStorage adds the latest Storage to the storages
-func (gs *GlobalStorage) AddLatestStorage(ctx context.Context, ghClient *github.Client, dq *net.DownloadQueue, cfg *viper.Viper) error {
+// AddLatestStorage adds the latest Storage to the storages.
+// It returns the latest Storage and whether it was newly created.
+func (gs *GlobalStorage) AddLatestStorage(ctx context.Context, ghClient *github.Client, dq *net.DownloadQueue, cfg *viper.Viper) (*Storage, bool, error) {
 	releaseDate, err := GetLatestReleaseDate(ctx, ghClient, cfg.GetString("github.repo"))
 	if err != nil {
-		return fmt.Errorf("unable to get latest release date: %w", err)
+		return nil, false, fmt.Errorf("unable to get latest release date: %w", err)
 	}
 	logger := log.WithField("release_date", releaseDate)
 	logger.Debugf("Got the newest release date")
@@ -44,19 +58,19 @@ func (gs *GlobalStorage) AddLatestStorage(ctx context.Context, ghClient *github.
 	if !ok {
 		logger.Info("Storage not found, creating a new one")
 		if s, err = GetPackageStorage(ctx, ghClient, dq, cfg, releaseDate); err != nil {
-			return fmt.Errorf("unable to get current package storage: %w", err)
+			return nil, false, fmt.Errorf("unable to get current package storage: %w", err)
 		}
 		logger.Debug("Saving the storage")
 		gs.Add(s.Date, s)
 		if err = s.Save(); err != nil {
-			return fmt.Errorf("unable to save new storage: %w", err)
+			return nil, false, fmt.Errorf("unable to save new storage: %w", err)
 		}
 		logger.Debug("Storage added successfully")
 	}
 
 	logger.Debug("Setting storage as current")
 	gs.Add(CurrentStorageKey, s)
-	return nil
+	return s, !ok, nil
 }
 
 // Add safely adds a new Storage to the storages
@@ -72,6 +86,25 @@ func (gs *GlobalStorage) Add(date string, s *Storage) {
 	gs.mtx.Unlock()
 }
 
+// AddIfMissing safely adds a new Storage unless there's already one for its date.
+// It returns the Storage kept in the storages, so that the concurrent callers share the same packages.
+func (gs *GlobalStorage) AddIfMissing(s *Storage) *Storage {
+	if s.Date == "" {
+		return s
+	}
+
+	gs.mtx.Lock()
+	defer gs.mtx.Unlock()
+	if existing, ok := gs.storages[s.Date]; ok {
+		return existing
+	}
+	if s.cache == nil {
+		s.cache = gs.cache
+	}
+	gs.storages[s.Date] = s
+	return s
+}
+
 // Get safely gets a Storage from the storages
 func (gs *GlobalStorage) Get(date string) (*Storage, bool) {
 	gs.mtx.RLock()
@@ -83,6 +116,114 @@ func (gs *GlobalStorage) Get(date string) (*Storage, bool) {
 	return s, ok
 }
 
+// Size returns the number of the storages and the packages in them
+func (gs *GlobalStorage) Size() (storages, packages int) {
+	gs.mtx.RLock()
+	defer gs.mtx.RUnlock()
+	for k, s := range gs.storages {
+		if k == CurrentStorageKey {
+			continue
+		}
+		storages++
+		s.mtx.RLock()
+		packages += s.Count
+		s.mtx.RUnlock()
+	}
+	return storages, packages
+}
+
+// Dates returns the list of release dates known to the GlobalStorage, newest first
+func (gs *GlobalStorage) Dates() []string {
+	gs.mtx.RLock()
+	defer gs.mtx.RUnlock()
+
+	dates := make([]string, 0, len(gs.storages))
+	for k := range gs.storages {
+		if k == CurrentStorageKey {
+			continue
+		}
+		dates = append(dates, k)
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(dates)))
+	return dates
+}
+
+// Purge removes the Storage from the storages, the cache and the targets which can delete the files.
+// It returns whether the Storage was the current one, in which case the current Storage is removed as well.
+func (gs *GlobalStorage) Purge(date string, targets []upload.Uploader) (bool, error) {
+	gs.mtx.Lock()
+	s, ok := gs.storages[date]
+	if !ok || date == CurrentStorageKey {
+		gs.mtx.Unlock()
+		return false, fmt.Errorf("unable to purge storage %s: %w", date, ErrStorageNotFound)
+	}
+	delete(gs.storages, date)
+	current := gs.storages[CurrentStorageKey] == s
+	if current {
+		delete(gs.storages, CurrentStorageKey)
+	}
+	gs.mtx.Unlock()
+
+	if err := gs.cache.Delete(date); err != nil {
+		return current, fmt.Errorf("unable to delete storage %s from cache: %w", date, err)
+	}
+
+	for _, t := range targets {
+		r, ok := t.(upload.Remover)
+		if !ok {
+			continue
+		}
+		for _, p := range s.Platforms() {
+			if err := r.Remove(p.String() + "/" + date); err != nil {
+				return current, fmt.Errorf("unable to remove storage %s from '%s': %w", date, t.Name(), err)
+			}
+		}
+	}
+	return current, nil
+}
+
+// Sweep finds the expired mirrors in all the storages and handles them according to 'gapps.expiry_policy':
+// "reupload" creates the mirrors again, "hide" (default) clears their URLs.
+func (gs *GlobalStorage) Sweep(ctx context.Context, dq *net.DownloadQueue, cfg *viper.Viper, targets []upload.Uploader) {
+	reupload := cfg.GetString("gapps.expiry_policy") == ExpiryPolicyReupload
+
+	gs.mtx.RLock()
+	storages := make([]*Storage, 0, len(gs.storages))
+	for k, s := range gs.storages {
+		if k != CurrentStorageKey {
+			storages = append(storages, s)
+		}
+	}
+	gs.mtx.RUnlock()
+
+	for _, s := range storages {
+		logger := log.WithField("release_date", s.Date)
+		expired := 0
+		for _, p := range s.List() {
+			count := p.Expire(!reupload)
+			if count == 0 {
+				continue
+			}
+			expired += count
+
+			logger.Debugf("Package %s has %d expired mirrors", p.Name, count)
+			if reupload {
+				if err := p.CreateMirror(ctx, dq, targets, nil); err != nil {
+					logger.Errorf("Unable to re-upload the package %s: %v", p.Name, err)
+				}
+			}
+		}
+		if expired == 0 {
+			continue
+		}
+
+		logger.Infof("Found %d expired mirrors", expired)
+		if err := s.Save(); err != nil {
+			logger.Errorf("Unable to save storage: %v", err)
+		}
+	}
+}
+
 // Save saves the GlobalStorage to the cache
 func (gs *GlobalStorage) Save() {
 	gs.mtx.RLock()
@@ -97,8 +238,14 @@ func (gs *GlobalStorage) Save() {
 	}
 }
 
-// Load loads the GlobalStorage from the cache
-func (gs *GlobalStorage) Load() error {
+// Load loads the GlobalStorage from the cache.
+// The legacy mirrors of the packages are kept only if the targets have their names.
+func (gs *GlobalStorage) Load(targets []upload.Uploader) error {
+	names := make(map[string]bool, len(targets))
+	for _, t := range targets {
+		names[t.Name()] = true
+	}
+
 	// check the cache first
 	cachedStorageList, err := gs.cache.Keys()
 	if err != nil {
@@ -106,7 +253,6 @@ func (gs *GlobalStorage) Load() error {
 	}
 	log.Debug("Got the release keys: ", cachedStorageList)
 
-	s := &Storage{}
 	var sBody []byte
 	for _, k := range cachedStorageList {
 		if sBody, err = gs.cache.Get(k); err != nil {
@@ -114,10 +260,12 @@ func (gs *GlobalStorage) Load() error {
 			continue
 		}
 
+		s := &Storage{}
 		if err = json.Unmarshal(sBody, s); err != nil {
 			log.Warnf("Unable to unmarshal storage from cache for package '%s': %v", k, err)
 			continue
 		}
+		s.migrate(names)
 
 		gs.Add(k, s)
 	}
@@ -127,3 +275,22 @@ func (gs *GlobalStorage) Load() error {
 	}
 	return nil
 }
+
+// PackageByPath returns the package by its relative path on the mirror, see Package.Path
+func (gs *GlobalStorage) PackageByPath(path string) (*Package, bool) {
+	parts := strings.Split(path, "/")
+	if len(parts) != 3 {
+		return nil, false
+	}
+
+	s, ok := gs.Get(parts[1])
+	if !ok {
+		return nil, false
+	}
+	for _, p := range s.List() {
+		if p.Platform.String() == parts[0] && p.Name == parts[2] {
+			return p, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,102 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nezorflame/opengapps-mirror-bot/internal/pkg/db"
+	"github.com/nezorflame/opengapps-mirror-bot/pkg/upload"
+
+	"github.com/spf13/viper"
+)
+
+func newTestDB(t *testing.T) (*db.DB, func()) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "storage-db-test")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	cache, err := db.NewDB(filepath.Join(dir, "bolt.db"), time.Second)
+	if err != nil {
+		t.Fatalf("unable to open DB: %v", err)
+	}
+	return cache, func() {
+		_ = cache.Close(false)
+		_ = os.RemoveAll(dir)
+	}
+}
+
+func TestSweep(t *testing.T) {
+	origin := newTestOrigin()
+	defer origin.Close()
+	dq, dir := newTestQueue(t)
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		policy string
+		// status and URL of the expired mirror after the sweep
+		status MirrorStatus
+		url    bool
+	}{
+		{ExpiryPolicyHide, MirrorExpired, false},
+		{ExpiryPolicyReupload, MirrorOK, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			cache, cleanup := newTestDB(t)
+			defer cleanup()
+			cfg := viper.New()
+			cfg.Set("gapps.expiry_policy", tt.policy)
+
+			now := time.Now()
+			p := newMirrorPackage(origin.URL)
+			p.Mirrors = []*Mirror{
+				{Name: "remote", URL: "https://remote/old", Status: MirrorOK, UploadedAt: now.Add(-48 * time.Hour), ExpiresAt: now.Add(-time.Hour)},
+				{Name: "local", URL: "https://local/file", Status: MirrorOK, UploadedAt: now.Add(-48 * time.Hour)},
+			}
+			// the current storage is skipped by the sweep
+			current := newMirrorPackage(origin.URL)
+			current.Mirrors = []*Mirror{{Name: "remote", URL: "https://remote/current", Status: MirrorOK, ExpiresAt: now.Add(-time.Hour)}}
+
+			gs := NewGlobalStorage(cache)
+			gs.Add(p.Date, testStorage([]*Package{p}))
+			gs.Add(CurrentStorageKey, testStorage([]*Package{current}))
+			targets := []upload.Uploader{&testTarget{name: "remote"}, &testTarget{name: "local"}}
+
+			gs.Sweep(context.Background(), dq, cfg, targets)
+
+			remote, _ := p.Mirror("remote")
+			if remote.Status != tt.status || (remote.URL != "") != tt.url {
+				t.Errorf("expired mirror = %s %q, want %s with URL %t", remote.Status, remote.URL, tt.status, tt.url)
+			}
+			if local, _ := p.Mirror("local"); local.Status != MirrorOK || local.URL == "" {
+				t.Errorf("healthy mirror is changed: %+v", local)
+			}
+			if m, _ := current.Mirror("remote"); m.Status != MirrorOK {
+				t.Errorf("mirror of the current storage is swept: %+v", m)
+			}
+
+			// the swept storage is saved
+			body, err := cache.Get(p.Date)
+			if err != nil {
+				t.Fatalf("unable to get the saved storage: %v", err)
+			}
+			var saved Storage
+			if err = json.Unmarshal(body, &saved); err != nil {
+				t.Fatalf("unable to unmarshal the saved storage: %v", err)
+			}
+			pkg, ok := saved.Get(p.Platform, p.Android, p.Variant)
+			if !ok {
+				t.Fatal("saved storage has no package")
+			}
+			if m, _ := pkg.Mirror("remote"); m.Status != tt.status {
+				t.Errorf("saved mirror status = %s, want %s", m.Status, tt.status)
+			}
+		})
+	}
+}
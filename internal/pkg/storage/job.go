@@ -0,0 +1,70 @@
+package storage
+
+import (
+	"context"
+	"sync"
+
+	"github.com/nezorflame/opengapps-mirror-bot/pkg/net"
+)
+
+// mirrorJob is the running mirror job of the package, shared by all of its callers
+type mirrorJob struct {
+	cancel    context.CancelFunc
+	done      chan struct{}
+	err       error
+	next      int
+	listeners map[int]net.ProgressFunc
+	mtx       sync.Mutex
+}
+
+// newMirrorJob creates the job along with its context.
+// The job context doesn't depend on any caller, it's cancelled when the last caller detaches.
+func newMirrorJob() (context.Context, *mirrorJob) {
+	ctx, cancel := context.WithCancel(context.Background())
+	return ctx, &mirrorJob{
+		cancel:    cancel,
+		done:      make(chan struct{}),
+		listeners: make(map[int]net.ProgressFunc),
+	}
+}
+
+// attach registers the caller with its (optional) progress func and returns the caller ID
+func (j *mirrorJob) attach(progress net.ProgressFunc) int {
+	j.mtx.Lock()
+	defer j.mtx.Unlock()
+	id := j.next
+	j.next++
+	j.listeners[id] = progress
+	return id
+}
+
+// detach removes the caller and returns the number of the remaining ones
+func (j *mirrorJob) detach(id int) int {
+	j.mtx.Lock()
+	defer j.mtx.Unlock()
+	delete(j.listeners, id)
+	return len(j.listeners)
+}
+
+// progress passes the job progress to every caller
+func (j *mirrorJob) progress(p net.Progress) {
+	j.mtx.Lock()
+	listeners := make([]net.ProgressFunc, 0, len(j.listeners))
+	for _, fn := range j.listeners {
+		if fn != nil {
+			listeners = append(listeners, fn)
+		}
+	}
+	j.mtx.Unlock()
+
+	for _, fn := range listeners {
+		fn(p)
+	}
+}
+
+// finish sets the job result and releases the callers
+func (j *mirrorJob) finish(err error) {
+	j.err = err
+	j.cancel()
+	close(j.done)
+}
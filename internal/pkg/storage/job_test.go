@@ -0,0 +1,165 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nezorflame/opengapps-mirror-bot/pkg/net"
+	"github.com/nezorflame/opengapps-mirror-bot/pkg/upload"
+)
+
+// waitStarted waits for the upload to the target to start
+func waitStarted(t *testing.T, target *testTarget) {
+	t.Helper()
+	select {
+	case <-target.started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("upload is not started")
+	}
+}
+
+// waitCallers waits for the callers to attach to the running job of the package
+func waitCallers(t *testing.T, p *Package, n int) {
+	t.Helper()
+	p.mtx.RLock()
+	j := p.job
+	p.mtx.RUnlock()
+	if j == nil {
+		t.Fatal("package has no running job")
+	}
+
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		j.mtx.Lock()
+		callers := len(j.listeners)
+		j.mtx.Unlock()
+		if callers == n {
+			return
+		}
+	}
+	t.Fatalf("%d callers are not attached to the job", n)
+}
+
+// waitResult waits for the result of the CreateMirror call
+func waitResult(t *testing.T, done <-chan error) error {
+	t.Helper()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(5 * time.Second):
+		t.Fatal("CreateMirror() is stuck")
+		return nil
+	}
+}
+
+func TestCreateMirrorCoalesced(t *testing.T) {
+	origin := newTestOrigin()
+	defer origin.Close()
+	dq, dir := newTestQueue(t)
+	defer os.RemoveAll(dir)
+
+	target := &testTarget{name: "remote", started: make(chan struct{}, 1), block: make(chan struct{})}
+	p := newMirrorPackage(origin.URL)
+
+	var (
+		progress = make([]int, 2)
+		mtx      sync.Mutex
+		done     = make(chan error, 2)
+	)
+	mirror := func(i int) {
+		done <- p.CreateMirror(context.Background(), dq, []upload.Uploader{target}, func(net.Progress) {
+			mtx.Lock()
+			progress[i]++
+			mtx.Unlock()
+		})
+	}
+
+	go mirror(0)
+	waitStarted(t, target)
+	// the second caller attaches to the job held in the upload
+	go mirror(1)
+	waitCallers(t, p, 2)
+	close(target.block)
+
+	for i := 0; i < 2; i++ {
+		if err := waitResult(t, done); err != nil {
+			t.Errorf("CreateMirror() returned error: %v", err)
+		}
+	}
+	if got := origin.count(); got != 2 {
+		t.Errorf("package is requested %d times, want 2 (one download of 2 chunks)", got)
+	}
+	if target.uploaded(p.Path()) == nil {
+		t.Error("package is not uploaded")
+	}
+	if len(target.started) != 0 {
+		t.Error("package is uploaded more than once")
+	}
+	if progress[1] == 0 {
+		t.Error("attached caller got no progress")
+	}
+}
+
+func TestCreateMirrorDetach(t *testing.T) {
+	origin := newTestOrigin()
+	defer origin.Close()
+	dq, dir := newTestQueue(t)
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name string
+		// stay keeps the second caller attached after the first one is gone
+		stay bool
+	}{
+		{"job continues for the remaining caller", true},
+		{"job is aborted with the last caller", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := &testTarget{name: "remote", started: make(chan struct{}, 1), block: make(chan struct{})}
+			p := newMirrorPackage(origin.URL)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			cancelled := make(chan error, 1)
+			go func() { cancelled <- p.CreateMirror(ctx, dq, []upload.Uploader{target}, nil) }()
+			waitStarted(t, target)
+
+			stayed := make(chan error, 1)
+			if tt.stay {
+				go func() { stayed <- p.CreateMirror(context.Background(), dq, []upload.Uploader{target}, nil) }()
+				waitCallers(t, p, 2)
+			}
+
+			cancel()
+			if err := waitResult(t, cancelled); !errors.Is(err, context.Canceled) {
+				t.Errorf("cancelled CreateMirror() error = %v, want %v", err, context.Canceled)
+			}
+
+			if !tt.stay {
+				// the job is cleaned up by the time the last caller returns
+				p.mtx.RLock()
+				running := p.job != nil
+				p.mtx.RUnlock()
+				if running {
+					t.Error("job is still running without callers")
+				}
+				if p.HasMirrors() {
+					t.Error("aborted job created the mirror")
+				}
+				return
+			}
+
+			close(target.block)
+			if err := waitResult(t, stayed); err != nil {
+				t.Errorf("remaining CreateMirror() returned error: %v", err)
+			}
+			if !p.HasMirrors() {
+				t.Error("job of the remaining caller created no mirror")
+			}
+		})
+	}
+}
@@ -1,127 +1,395 @@
 package storage
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
-	"net/http"
+	"net/url"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/nezorflame/opengapps-mirror-bot/internal/pkg/metrics"
 	"github.com/nezorflame/opengapps-mirror-bot/pkg/gapps"
 	"github.com/nezorflame/opengapps-mirror-bot/pkg/net"
+	"github.com/nezorflame/opengapps-mirror-bot/pkg/upload"
 
 	"github.com/google/go-github/v37/github"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
 )
 
-const gappsSeparator = "-"
+const (
+	gappsSeparator = "-"
+	expiryMargin   = time.Hour
+)
 
 // Package describes the OpenGApps package
 type Package struct {
 	Name      string         `json:"name"`
 	Date      string         `json:"date"`
 	OriginURL string         `json:"origin_url"`
-	LocalURL  string         `json:"local_url"`
-	RemoteURL string         `json:"remote_url"`
+	Mirrors   []*Mirror      `json:"mirrors,omitempty"`
 	MD5       string         `json:"md5"`
+	SHA1      string         `json:"sha1,omitempty"`
+	SHA256    string         `json:"sha256,omitempty"`
 	Size      int            `json:"size"`
 	Platform  gapps.Platform `json:"platform"`
 	Android   gapps.Android  `json:"android"`
 	Variant   gapps.Variant  `json:"variant"`
+
+	// Deprecated: LocalURL and RemoteURL are only used to migrate the cached storages, use Mirrors instead
+	LocalURL  string `json:"local_url,omitempty"`
+	RemoteURL string `json:"remote_url,omitempty"`
+
+	job *mirrorJob
+	mtx sync.RWMutex
+}
+
+// MirrorStatus describes the state of the package mirror
+type MirrorStatus string
+
+// MirrorStatus consts
+const (
+	MirrorPending MirrorStatus = "pending"
+	MirrorOK      MirrorStatus = "ok"
+	MirrorFailed  MirrorStatus = "failed"
+	MirrorExpired MirrorStatus = "expired"
+)
+
+// Mirror describes the package mirror on one of the mirror targets
+type Mirror struct {
+	Name       string       `json:"name"`
+	Host       string       `json:"host"`
+	URL        string       `json:"url,omitempty"`
+	Status     MirrorStatus `json:"status"`
+	UploadedAt time.Time    `json:"uploaded_at"`
+	ExpiresAt  time.Time    `json:"expires_at"`
+}
+
+// Expired checks if the mirror has expired or is about to expire
+func (m *Mirror) Expired(now time.Time) bool {
+	return m.Status == MirrorExpired || !m.ExpiresAt.IsZero() && now.Add(expiryMargin).After(m.ExpiresAt)
+}
+
+// Healthy checks if the mirror is OK to be served
+func (m *Mirror) Healthy(now time.Time) bool {
+	return m.Status == MirrorOK && m.URL != "" && !m.Expired(now)
+}
+
+func (m *Mirror) uploaded(url string, ttl time.Duration) {
+	m.URL, m.Status, m.UploadedAt = url, MirrorOK, time.Now()
+	m.ExpiresAt = time.Time{}
+	if ttl > 0 {
+		m.ExpiresAt = m.UploadedAt.Add(ttl)
+	}
+}
+
+// HasMirrors checks if the package has any healthy mirrors
+func (p *Package) HasMirrors() bool {
+	return len(p.HealthyMirrors()) > 0
+}
+
+// HealthyMirrors returns the copies of the non-expired mirrors with the OK status
+func (p *Package) HealthyMirrors() []*Mirror {
+	p.mtx.RLock()
+	defer p.mtx.RUnlock()
+
+	now := time.Now()
+	result := make([]*Mirror, 0, len(p.Mirrors))
+	for _, m := range p.Mirrors {
+		if m.Healthy(now) {
+			c := *m
+			result = append(result, &c)
+		}
+	}
+	return result
 }
 
-// CreateMirror creates a new mirror for the package
-func (p *Package) CreateMirror(dq *net.DownloadQueue, cfg *viper.Viper) error {
-	if cfg.GetString("gapps.local_url") != "" && p.LocalURL != "" ||
-		cfg.GetString("gapps.remote_url") != "" && p.RemoteURL != "" {
+// Expire marks the expired mirrors of the package, clearing their URLs if needed.
+// It returns the number of newly expired mirrors.
+func (p *Package) Expire(clear bool) int {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	now, count := time.Now(), 0
+	for _, m := range p.Mirrors {
+		if m.Status != MirrorOK || !m.Expired(now) {
+			continue
+		}
+		m.Status = MirrorExpired
+		if clear {
+			m.URL = ""
+		}
+		count++
+	}
+	return count
+}
+
+// ClearMirrors discards all the package mirrors so that they're created anew.
+// It returns false if the package is being mirrored right now.
+func (p *Package) ClearMirrors() bool {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	if p.job != nil {
+		return false
+	}
+	p.Mirrors = nil
+	return true
+}
+
+// Mirror returns the copy of the mirror by the target name
+func (p *Package) Mirror(name string) (*Mirror, bool) {
+	p.mtx.RLock()
+	defer p.mtx.RUnlock()
+
+	m, ok := p.mirror(name)
+	if !ok {
+		return nil, false
+	}
+	c := *m
+	return &c, true
+}
+
+// Checksums returns the known checksums of the package.
+// SHA-1 and SHA-256 are empty until the package is downloaded for the first time.
+func (p *Package) Checksums() net.Checksums {
+	p.mtx.RLock()
+	defer p.mtx.RUnlock()
+	return net.Checksums{MD5: p.MD5, SHA1: p.SHA1, SHA256: p.SHA256}
+}
+
+// MarshalJSON safely marshals the package while its mirrors may be updated
+func (p *Package) MarshalJSON() ([]byte, error) {
+	type plain Package
+	p.mtx.RLock()
+	defer p.mtx.RUnlock()
+	return json.Marshal((*plain)(p))
+}
+
+// CreateMirror creates the missing mirrors for the package on every target.
+// A failed target doesn't fail the whole call unless none of the targets has a healthy mirror.
+// Progress is optional and is reported for every stage of the mirroring.
+//
+// Concurrent calls for the same package are coalesced: the later callers attach to the running job,
+// receive its progress and get the same result. The job is aborted once all of its callers are done.
+func (p *Package) CreateMirror(ctx context.Context, dq *net.DownloadQueue, targets []upload.Uploader, progress net.ProgressFunc) error {
+	p.mtx.Lock()
+	j := p.job
+	if j == nil {
+		var jobCtx context.Context
+		jobCtx, j = newMirrorJob()
+		p.job = j
+		go func() {
+			err := p.createMirror(jobCtx, dq, targets, j.progress)
+			p.mtx.Lock()
+			if p.job == j {
+				p.job = nil
+			}
+			p.mtx.Unlock()
+			j.finish(err)
+		}()
+	} else {
+		log.Debugf("Attaching to the running mirror job of the package %s", p.Name)
+	}
+	id := j.attach(progress)
+	p.mtx.Unlock()
+
+	select {
+	case <-j.done:
+		p.detach(j, id)
+		return j.err
+	case <-ctx.Done():
+		if p.detach(j, id) {
+			// wait for the job to clean up after the cancellation
+			<-j.done
+		}
+		return fmt.Errorf("mirroring aborted: %w", ctx.Err())
+	}
+}
+
+// detach removes the caller from the job, cancelling it if there are no callers left.
+// It returns true if the job was cancelled.
+func (p *Package) detach(j *mirrorJob, id int) bool {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	if j.detach(id) > 0 || p.job != j {
+		return false
+	}
+	p.job = nil
+	j.cancel()
+	return true
+}
+
+func (p *Package) createMirror(ctx context.Context, dq *net.DownloadQueue, targets []upload.Uploader, progress net.ProgressFunc) error {
+	// pick the targets without the healthy mirror
+	p.mtx.Lock()
+	now := time.Now()
+	pending := make([]upload.Uploader, 0, len(targets))
+	for _, t := range targets {
+		m, ok := p.mirror(t.Name())
+		if !ok {
+			m = &Mirror{Name: t.Name()}
+			p.Mirrors = append(p.Mirrors, m)
+		}
+		m.Host = t.Host()
+		if !m.Healthy(now) {
+			m.Status = MirrorPending
+			pending = append(pending, t)
+		}
+	}
+	p.mtx.Unlock()
+	if len(pending) == 0 {
 		return nil
 	}
 
 	// download the file
-	filePath, err := dq.AddMultiple(p.OriginURL, p.MD5, 20, p.Size)
+	filePath, sums, err := dq.AddMultiple(ctx, p.OriginURL, p.MD5, p.Size, progress)
 	if err != nil {
+		p.setStatus(pending, MirrorFailed)
 		return fmt.Errorf("unable to read file body: %w", err)
 	}
 	log.Debugf("Package downloaded to %s", filePath)
 
-	// if we have local_path set, save the file there
-	if localPath := cfg.GetString("gapps.local_path"); localPath != "" {
-		if filePath, err = p.move(filePath, localPath); err != nil {
-			return fmt.Errorf("unable to move the file to storage: %w", err)
+	// the release only provides MD5, the other checksums are known after the download
+	p.mtx.Lock()
+	p.SHA1, p.SHA256 = sums.SHA1, sums.SHA256
+	p.mtx.Unlock()
+
+	// let the local targets take the file over first, delete it in the end otherwise
+	moved := false
+	for _, t := range pending {
+		mover, ok := t.(upload.Mover)
+		if !ok || moved || ctx.Err() != nil {
+			continue
+		}
+		if progress != nil {
+			progress(net.Progress{Stage: net.StageMove})
 		}
-		log.Debugf("Package moved to %s", filePath)
 
-		// if we have local_url set, provide the local server URL
-		if localURL := cfg.GetString("gapps.local_url"); localURL != "" {
-			relPath := strings.TrimPrefix(filePath, localPath)
-			p.LocalURL = fmt.Sprintf(localURL, relPath)
-			log.Debugf("Local URL is %s", p.LocalURL)
+		mirrorURL, dest, err := mover.Move(p.Path(), filePath)
+		if err != nil {
+			// e.g. the target is on another device, the file is copied to it with the other targets then
+			log.Warnf("Unable to move the package %s to '%s', uploading it instead: %v", p.Name, t.Name(), err)
+			continue
 		}
-	} else {
-		// delete the file in the end otherwise
+		metrics.Uploads.WithLabelValues(t.Name(), metrics.ResultOK).Inc()
+		p.uploaded(t, mirrorURL)
+		filePath, moved = dest, true
+		log.Debugf("Package moved to %s, URL is %s", filePath, mirrorURL)
+	}
+	if !moved {
 		log.Debug("Temp file will be deleted")
 		defer os.Remove(filePath)
 	}
 
-	// if we have remote_url set, send the file to remote URL
-	if remoteURL := cfg.GetString("gapps.remote_url"); remoteURL != "" {
-		tmpFile, err := os.Open(filePath)
-		if err != nil {
-			return fmt.Errorf("unable to create temp file: %w", err)
+	// send the file to every other target, including the ones which failed to take it over
+	for _, t := range pending {
+		if m, _ := p.Mirror(t.Name()); m.Status != MirrorPending {
+			continue
 		}
-		defer tmpFile.Close()
 
-		req, err := http.NewRequest(http.MethodPut, fmt.Sprintf(remoteURL, p.Name), tmpFile)
+		mirrorURL, err := p.upload(ctx, t, filePath, progress)
+		metrics.Uploads.WithLabelValues(t.Name(), metrics.Result(err)).Inc()
 		if err != nil {
-			return fmt.Errorf("unable to create upload request: %w", err)
+			log.Errorf("Unable to upload the package %s to '%s': %v", p.Name, t.Name(), err)
+			p.setStatus([]upload.Uploader{t}, MirrorFailed)
+			continue
 		}
-		req.Header.Set("Content-Type", "application/zip")
-		req.Header.Set("Max-Days", "7")
+		p.uploaded(t, mirrorURL)
+		log.Debugf("Package uploaded to '%s', URL is %s", t.Name(), mirrorURL)
+	}
 
-		resp, err := http.DefaultClient.Do(req)
-		if err != nil {
-			return fmt.Errorf("unable to make upload request: %w", err)
-		}
-		defer resp.Body.Close()
+	if err = ctx.Err(); err != nil {
+		return fmt.Errorf("mirroring aborted: %w", err)
+	}
+	if !p.HasMirrors() {
+		return errors.New("unable to create any mirror")
+	}
+	return nil
+}
 
-		if resp.StatusCode != http.StatusOK {
-			return fmt.Errorf("unable to make upload request: %v", resp.Status)
-		}
+// Path returns the relative package path on the mirror
+func (p *Package) Path() string {
+	return p.Platform.String() + "/" + p.Date + "/" + p.Name
+}
 
-		result, err := ioutil.ReadAll(resp.Body)
-		if err != nil {
-			return fmt.Errorf("unable to read mirror response body: %w", err)
+func (p *Package) mirror(name string) (*Mirror, bool) {
+	for _, m := range p.Mirrors {
+		if m.Name == name {
+			return m, true
 		}
-
-		p.RemoteURL = string(result)
-		log.Debugf("File uploaded, remote URL is %s", p.RemoteURL)
 	}
+	return nil, false
+}
 
-	return nil
+func (p *Package) setStatus(targets []upload.Uploader, status MirrorStatus) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	for _, t := range targets {
+		if m, ok := p.mirror(t.Name()); ok {
+			m.Status = status
+		}
+	}
 }
 
-func (p *Package) move(origin, destFolder string) (string, error) {
-	path := destFolder + p.Platform.String() + "/" + p.Date
-	if err := os.MkdirAll(path, 0755); err != nil {
-		return "", fmt.Errorf("unable to create folder: %w", err)
+func (p *Package) uploaded(t upload.Uploader, url string) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	if m, ok := p.mirror(t.Name()); ok {
+		m.uploaded(url, t.TTL())
 	}
+}
 
-	path += "/" + p.Name
-	if err := os.Rename(origin, path); err != nil {
-		return "", fmt.Errorf("unable to move file: %w", err)
+func (p *Package) upload(ctx context.Context, u upload.Uploader, filePath string, progress net.ProgressFunc) (string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", fmt.Errorf("unable to open the file: %w", err)
 	}
+	defer file.Close()
 
-	if err := os.Chmod(path, 0755); err != nil {
-		return "", fmt.Errorf("unable to set file permissions: %w", err)
+	info, err := file.Stat()
+	if err != nil {
+		return "", fmt.Errorf("unable to get file info: %w", err)
 	}
 
-	return path, nil
+	body := net.NewProgressReader(file, net.StageUpload, info.Size(), progress)
+	return u.Upload(ctx, p.Path(), body, info.Size())
+}
+
+// migrate moves the deprecated fields of the cached package to the actual ones
+func (p *Package) migrate(targets map[string]bool) {
+	legacy := [][2]string{{"local", p.LocalURL}, {"remote", p.RemoteURL}}
+	for _, l := range legacy {
+		name, legacyURL := l[0], l[1]
+		if legacyURL == "" {
+			continue
+		}
+		// the mirror is dropped if no configured target takes it over, as it could never be renewed or swept
+		if !targets[name] {
+			log.WithField("package", p.Name).Debugf("Dropping the legacy %s mirror without a target", name)
+			continue
+		}
+		host := legacyURL
+		if u, err := url.Parse(legacyURL); err == nil && u.Host != "" {
+			host = u.Host
+		}
+		m := &Mirror{Name: name, Host: host, URL: legacyURL, Status: MirrorOK}
+		if name == "remote" {
+			// the legacy remote mirrors were uploaded for a week at most, and the upload time is unknown
+			m.Status = MirrorExpired
+		}
+		p.Mirrors = append(p.Mirrors, m)
+	}
+	p.LocalURL, p.RemoteURL = "", ""
 }
 
-func formPackage(dq *net.DownloadQueue, cfg *viper.Viper, zipAsset, md5Asset *github.ReleaseAsset) (*Package, error) {
-	md5sum, err := getMD5(dq, md5Asset.GetBrowserDownloadURL())
+func formPackage(ctx context.Context, dq *net.DownloadQueue, cfg *viper.Viper, zipAsset, md5Asset *github.ReleaseAsset) (*Package, error) {
+	md5sum, err := getMD5(ctx, dq, md5Asset.GetBrowserDownloadURL())
 	if err != nil {
 		return nil, fmt.Errorf("unable to download md5: %w", err)
 	}
@@ -134,11 +402,12 @@ func formPackage(dq *net.DownloadQueue, cfg *viper.Viper, zipAsset, md5Asset *gi
 	return p, nil
 }
 
-func getMD5(dq *net.DownloadQueue, url string) (string, error) {
-	filePath, err := dq.AddSingle(url)
+func getMD5(ctx context.Context, dq *net.DownloadQueue, url string) (string, error) {
+	filePath, err := dq.AddSingle(ctx, url)
 	if err != nil {
 		return "", fmt.Errorf("unable to download MD5 file: %w", err)
 	}
+	defer os.Remove(filePath)
 
 	file, err := os.Open(filePath)
 	if err != nil {
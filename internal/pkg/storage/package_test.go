@@ -0,0 +1,178 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nezorflame/opengapps-mirror-bot/pkg/gapps"
+	"github.com/nezorflame/opengapps-mirror-bot/pkg/net"
+	"github.com/nezorflame/opengapps-mirror-bot/pkg/upload"
+)
+
+var testZip = bytes.Repeat([]byte("zip"), 1000)
+
+// testTarget is the mirror target keeping the uploaded files in memory
+type testTarget struct {
+	name    string
+	moveErr error
+	// started is notified of every upload, which is held until block is closed (if set)
+	started chan struct{}
+	block   chan struct{}
+
+	mtx     sync.Mutex
+	uploads map[string][]byte
+	moves   int
+}
+
+func (t *testTarget) Name() string       { return t.name }
+func (t *testTarget) Host() string       { return t.name + ".example.com" }
+func (t *testTarget) TTL() time.Duration { return 0 }
+
+func (t *testTarget) Upload(ctx context.Context, path string, r io.Reader, _ int64) (string, error) {
+	if t.started != nil {
+		t.started <- struct{}{}
+	}
+	if t.block != nil {
+		select {
+		case <-t.block:
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+	body, err := ioutil.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	if t.uploads == nil {
+		t.uploads = make(map[string][]byte)
+	}
+	t.uploads[path] = body
+	return "https://" + t.Host() + "/" + path, nil
+}
+
+func (t *testTarget) uploaded(path string) []byte {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	return t.uploads[path]
+}
+
+// testMover is the mirror target able to take the downloaded file over
+type testMover struct {
+	testTarget
+	dir string
+}
+
+func (t *testMover) Move(path, src string) (string, string, error) {
+	t.mtx.Lock()
+	t.moves++
+	t.mtx.Unlock()
+	if t.moveErr != nil {
+		return "", "", t.moveErr
+	}
+	dest := t.dir + "/moved.zip"
+	if err := os.Rename(src, dest); err != nil {
+		return "", "", err
+	}
+	return "https://" + t.Host() + "/" + path, dest, nil
+}
+
+// testOrigin serves the test package, counting the requests
+type testOrigin struct {
+	*httptest.Server
+	mtx      sync.Mutex
+	requests int
+}
+
+func newTestOrigin() *testOrigin {
+	o := &testOrigin{}
+	o.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		o.mtx.Lock()
+		o.requests++
+		o.mtx.Unlock()
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(testZip))
+	}))
+	return o
+}
+
+func (o *testOrigin) count() int {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+	return o.requests
+}
+
+func newTestQueue(t *testing.T) (*net.DownloadQueue, string) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "storage-test")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	return net.NewQueue(context.Background(), net.Options{MaxDownloads: 4, Chunks: 2, Dir: dir}), dir
+}
+
+func newMirrorPackage(originURL string) *Package {
+	sum := md5.Sum(testZip)
+	return &Package{
+		Name:      "open_gapps-arm64-10.0-nano-20200101.zip",
+		Date:      "20200101",
+		OriginURL: originURL,
+		MD5:       hex.EncodeToString(sum[:]),
+		Size:      len(testZip),
+		Platform:  gapps.PlatformArm64,
+		Android:   gapps.Android100,
+		Variant:   gapps.VariantNano,
+	}
+}
+
+func TestCreateMirrorMoveFallback(t *testing.T) {
+	origin := newTestOrigin()
+	defer origin.Close()
+	dq, dir := newTestQueue(t)
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name    string
+		moveErr error
+		moved   bool
+	}{
+		{"moved", nil, true},
+		{"cross-device move is uploaded", errors.New("invalid cross-device link"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			local := &testMover{testTarget: testTarget{name: "local", moveErr: tt.moveErr}, dir: dir}
+			remote := &testTarget{name: "remote"}
+			p := newMirrorPackage(origin.URL)
+
+			if err := p.CreateMirror(context.Background(), dq, []upload.Uploader{local, remote}, nil); err != nil {
+				t.Fatalf("CreateMirror() returned error: %v", err)
+			}
+			for _, name := range []string{"local", "remote"} {
+				if m, ok := p.Mirror(name); !ok || !m.Healthy(time.Now()) {
+					t.Errorf("mirror '%s' is not healthy: %+v", name, m)
+				}
+			}
+			if local.moves != 1 {
+				t.Errorf("file is moved %d times, want 1", local.moves)
+			}
+			if got := local.uploaded(p.Path()) != nil; got == tt.moved {
+				t.Errorf("file is uploaded to the local target: %t, want %t", got, !tt.moved)
+			}
+			if !bytes.Equal(remote.uploaded(p.Path()), testZip) {
+				t.Error("remote target got the wrong file")
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/nezorflame/opengapps-mirror-bot/pkg/gapps"
+	"github.com/nezorflame/opengapps-mirror-bot/pkg/net"
+	"github.com/nezorflame/opengapps-mirror-bot/pkg/upload"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// PackageKey identifies the package inside of the Storage
+type PackageKey struct {
+	Platform gapps.Platform `json:"platform"`
+	Android  gapps.Android  `json:"android"`
+	Variant  gapps.Variant  `json:"variant"`
+}
+
+// String returns the key in the package name format
+func (k PackageKey) String() string {
+	return strings.Join([]string{k.Platform.String(), k.Android.HumanString(), k.Variant.String()}, gappsSeparator)
+}
+
+// ParsePackageKey parses the key from the space-separated platform, Android version and variant
+func ParsePackageKey(s string) (PackageKey, error) {
+	platform, android, variant, err := gapps.ParsePackageParts(strings.Fields(strings.Replace(s, ".", "", -1)))
+	if err != nil {
+		return PackageKey{}, fmt.Errorf("unable to parse package key '%s': %w", s, err)
+	}
+	return PackageKey{Platform: platform, Android: android, Variant: variant}, nil
+}
+
+// PreMirror creates the mirrors for the selected packages of the Storage, saving it after each mirror.
+// Mirrors are created concurrently within the DownloadQueue limits.
+func (s *Storage) PreMirror(ctx context.Context, dq *net.DownloadQueue, targets []upload.Uploader, keys []PackageKey) {
+	logger := log.WithField("release_date", s.Date)
+
+	var wg sync.WaitGroup
+	for _, k := range keys {
+		pkg, ok := s.Get(k.Platform, k.Android, k.Variant)
+		if !ok {
+			logger.Debugf("Package %s is not found, skipping", k)
+			continue
+		}
+
+		wg.Add(1)
+		go func(pkg *Package) {
+			defer wg.Done()
+			logger.Debugf("Pre-mirroring the package %s", pkg.Name)
+			if err := pkg.CreateMirror(ctx, dq, targets, nil); err != nil {
+				logger.Errorf("Unable to pre-mirror the package %s: %v", pkg.Name, err)
+				return
+			}
+			if err := s.Save(); err != nil {
+				logger.Errorf("Unable to save storage: %v", err)
+				return
+			}
+			logger.Infof("Package %s is pre-mirrored", pkg.Name)
+		}(pkg)
+	}
+	wg.Wait()
+}
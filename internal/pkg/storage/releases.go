@@ -0,0 +1,168 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/nezorflame/opengapps-mirror-bot/internal/pkg/db"
+	"github.com/nezorflame/opengapps-mirror-bot/pkg/gapps"
+
+	"github.com/google/go-github/v37/github"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+const (
+	releasesBucket  = "releases"
+	releasesPerPage = 100
+)
+
+// Releases keeps the release dates of every platform repo, cached in the DB for 'gapps.releases_ttl'
+type Releases struct {
+	gh     *github.Client
+	cfg    *viper.Viper
+	bucket *db.Bucket
+	mtx    sync.Mutex
+}
+
+type releaseList struct {
+	Dates     []string  `json:"dates"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// NewReleases creates a new Releases instance
+func NewReleases(cache *db.DB, gh *github.Client, cfg *viper.Viper) (*Releases, error) {
+	bucket, err := cache.Bucket(releasesBucket)
+	if err != nil {
+		return nil, fmt.Errorf("unable to init releases bucket: %w", err)
+	}
+	return &Releases{gh: gh, cfg: cfg, bucket: bucket}, nil
+}
+
+// Dates returns the release dates of the platform, newest first
+func (r *Releases) Dates(ctx context.Context, p gapps.Platform) ([]string, error) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	logger := log.WithField("platform", p)
+	list := &releaseList{}
+	body, err := r.bucket.Get(p.String())
+	switch {
+	case err == nil:
+		if err = json.Unmarshal(body, list); err != nil {
+			logger.Warnf("Unable to unmarshal the cached release dates: %v", err)
+		} else if time.Since(list.UpdatedAt) < r.cfg.GetDuration("gapps.releases_ttl") {
+			return list.Dates, nil
+		}
+	case !errors.Is(err, db.ErrNotFound):
+		logger.Warnf("Unable to get the cached release dates: %v", err)
+	}
+
+	dates, err := listReleaseDates(ctx, r.gh, r.cfg, p)
+	if err != nil {
+		return nil, err
+	}
+	logger.Debugf("Got %d release dates from Github", len(dates))
+
+	if body, err = json.Marshal(&releaseList{Dates: dates, UpdatedAt: time.Now()}); err != nil {
+		return nil, fmt.Errorf("unable to marshal release dates: %w", err)
+	}
+	if err = r.bucket.Put(p.String(), body); err != nil {
+		logger.Errorf("Unable to cache the release dates: %v", err)
+	}
+	return dates, nil
+}
+
+// AllDates returns the release dates of all the platforms, newest first.
+// The platforms which failed to load are skipped, unless all of them have failed.
+func (r *Releases) AllDates(ctx context.Context) ([]string, error) {
+	var (
+		seen   = make(map[string]bool)
+		result []string
+		err    error
+	)
+	for _, p := range gapps.PlatformValues() {
+		var dates []string
+		if dates, err = r.Dates(ctx, p); err != nil {
+			log.WithField("platform", p).Errorf("Unable to get the release dates: %v", err)
+			continue
+		}
+		for _, d := range dates {
+			if !seen[d] {
+				seen[d] = true
+				result = append(result, d)
+			}
+		}
+	}
+	if len(seen) == 0 && err != nil {
+		return nil, err
+	}
+
+	sort.Sort(sort.Reverse(sort.StringSlice(result)))
+	return result, nil
+}
+
+// Exists checks if there's a release with the date for any of the platforms
+func (r *Releases) Exists(ctx context.Context, date string) (bool, error) {
+	dates, err := r.AllDates(ctx)
+	if err != nil {
+		return false, err
+	}
+	for _, d := range dates {
+		if d == date {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Invalidate drops the cached release dates, so that they're fetched again on the next request
+func (r *Releases) Invalidate() {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	for _, p := range gapps.PlatformValues() {
+		if err := r.bucket.Delete(p.String()); err != nil {
+			log.WithField("platform", p).Errorf("Unable to drop the cached release dates: %v", err)
+		}
+	}
+}
+
+// listReleaseDates pages through the platform repo releases, newest first.
+// Only the tags matching 'gapps.time_format' are returned.
+func listReleaseDates(ctx context.Context, ghClient *github.Client, cfg *viper.Viper, p gapps.Platform) ([]string, error) {
+	var (
+		dates []string
+		opts  = &github.ListOptions{PerPage: releasesPerPage}
+	)
+	for {
+		releases, resp, err := ghClient.Repositories.ListReleases(ctx, cfg.GetString("github.repo"), p.String(), opts)
+		observeGithub("list_releases", resp, err)
+		if err != nil {
+			return nil, fmt.Errorf("unable to list releases from Github: %w", err)
+		}
+
+		for _, release := range releases {
+			tag := release.GetTagName()
+			if release.GetDraft() {
+				continue
+			}
+			if _, err = time.Parse(cfg.GetString("gapps.time_format"), tag); err != nil {
+				continue
+			}
+			dates = append(dates, tag)
+		}
+
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+
+	sort.Sort(sort.Reverse(sort.StringSlice(dates)))
+	return dates, nil
+}
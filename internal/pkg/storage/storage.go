@@ -15,6 +15,7 @@ import (
 	"github.com/spf13/viper"
 
 	"github.com/nezorflame/opengapps-mirror-bot/internal/pkg/db"
+	"github.com/nezorflame/opengapps-mirror-bot/internal/pkg/metrics"
 	"github.com/nezorflame/opengapps-mirror-bot/pkg/gapps"
 	"github.com/nezorflame/opengapps-mirror-bot/pkg/net"
 )
@@ -27,8 +28,10 @@ type Storage struct {
 	Date     string                                                          `json:"date"`
 	Count    int                                                             `json:"count"`
 	Packages map[gapps.Platform]map[gapps.Android]map[gapps.Variant]*Package `json:"packages"`
-	cache    *db.DB
-	mtx      sync.RWMutex
+	// Matrix holds the package combinations observed in the release assets
+	Matrix *gapps.Matrix `json:"matrix,omitempty"`
+	cache  *db.DB
+	mtx    sync.RWMutex
 }
 
 // GetPackageStorage creates and fills a new Storage
@@ -39,6 +42,7 @@ func GetPackageStorage(ctx context.Context, ghClient *github.Client, dq *net.Dow
 	}
 
 	storage := &Storage{Packages: make(map[gapps.Platform]map[gapps.Android]map[gapps.Variant]*Package, len(releases))}
+	var combos []gapps.Combo
 	for _, release := range releases {
 		zipSlice := make([]*github.ReleaseAsset, 0, len(release.Assets))
 		md5Slice := make([]*github.ReleaseAsset, 0, len(release.Assets))
@@ -52,6 +56,9 @@ func GetPackageStorage(ctx context.Context, ghClient *github.Client, dq *net.Dow
 			name := asset.GetName()
 			if strings.HasSuffix(name, "zip") {
 				zipSlice = append(zipSlice, asset)
+				if p, err := parseAsset(cfg, asset, ""); err == nil {
+					combos = append(combos, gapps.Combo{Platform: p.Platform, Android: p.Android, Variant: p.Variant})
+				}
 			}
 
 			if strings.HasSuffix(name, "md5") {
@@ -65,7 +72,7 @@ func GetPackageStorage(ctx context.Context, ghClient *github.Client, dq *net.Dow
 		for i := 0; i < len(zipSlice); i++ {
 			go func(wg *sync.WaitGroup, i int) {
 				defer wg.Done()
-				p, err := formPackage(dq, cfg, zipSlice[i], md5Slice[i])
+				p, err := formPackage(ctx, dq, cfg, zipSlice[i], md5Slice[i])
 				if err != nil {
 					log.Errorf("Unable to form package: %v", err)
 					return
@@ -74,11 +81,54 @@ func GetPackageStorage(ctx context.Context, ghClient *github.Client, dq *net.Dow
 			}(&wg, i)
 		}
 		wg.Wait()
+
+		// the packages failed by the cancelled context are missing, so the partial storage is never returned
+		if err = ctx.Err(); err != nil {
+			return nil, fmt.Errorf("unable to get packages of release %s: %w", releaseTag, err)
+		}
 	}
 
+	if storage.Count == 0 {
+		return nil, fmt.Errorf("release %s has no packages: %w", releaseTag, ErrStorageNotFound)
+	}
+	storage.Matrix = gapps.NewMatrix(combos)
 	return storage, nil
 }
 
+// GetReleaseMatrix returns the release date and the package combinations built for it.
+// Unlike GetPackageStorage, it only parses the release asset names and downloads nothing.
+func GetReleaseMatrix(ctx context.Context, ghClient *github.Client, cfg *viper.Viper, releaseTag string) (string, *gapps.Matrix, error) {
+	releases, err := getAllReleasesByTag(ctx, ghClient, cfg.GetString("github.repo"), releaseTag)
+	if err != nil {
+		return "", nil, fmt.Errorf("unable to get latest releases from Github: %w", err)
+	}
+
+	var (
+		date   string
+		combos []gapps.Combo
+	)
+	for _, release := range releases {
+		for _, asset := range release.Assets {
+			if asset == nil || !strings.HasSuffix(asset.GetName(), "zip") {
+				continue
+			}
+			p, err := parseAsset(cfg, asset, "")
+			if err != nil {
+				continue
+			}
+			if date == "" {
+				date = p.Date
+			}
+			combos = append(combos, gapps.Combo{Platform: p.Platform, Android: p.Android, Variant: p.Variant})
+		}
+	}
+
+	if len(combos) == 0 {
+		return "", nil, fmt.Errorf("release %s has no packages: %w", releaseTag, ErrStorageNotFound)
+	}
+	return date, gapps.NewMatrix(combos), nil
+}
+
 // Add safely adds a new package to the Storage
 func (s *Storage) Add(p *Package) {
 	s.mtx.Lock()
@@ -111,6 +161,73 @@ func (s *Storage) Get(p gapps.Platform, a gapps.Android, v gapps.Variant) (*Pack
 	return result, ok
 }
 
+// Len safely returns the number of the packages in the Storage
+func (s *Storage) Len() int {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	return s.Count
+}
+
+// List returns all the packages from the Storage, ordered by platform, Android version and variant
+func (s *Storage) List() []*Package {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	result := make([]*Package, 0, s.Count)
+	for _, p := range gapps.PlatformValues() {
+		for _, a := range gapps.AndroidValues() {
+			for _, v := range gapps.VariantValues() {
+				if pkg, ok := s.Packages[p][a][v]; ok {
+					result = append(result, pkg)
+				}
+			}
+		}
+	}
+	return result
+}
+
+// Platforms returns the list of platforms available in the Storage
+func (s *Storage) Platforms() []gapps.Platform {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	var result []gapps.Platform
+	for _, p := range gapps.PlatformValues() {
+		if len(s.Packages[p]) > 0 {
+			result = append(result, p)
+		}
+	}
+	return result
+}
+
+// Androids returns the list of Android versions available in the Storage for the platform
+func (s *Storage) Androids(p gapps.Platform) []gapps.Android {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	var result []gapps.Android
+	for _, a := range gapps.AndroidValues() {
+		if len(s.Packages[p][a]) > 0 {
+			result = append(result, a)
+		}
+	}
+	return result
+}
+
+// Variants returns the list of variants available in the Storage for the platform and Android version
+func (s *Storage) Variants(p gapps.Platform, a gapps.Android) []gapps.Variant {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	var result []gapps.Variant
+	for _, v := range gapps.VariantValues() {
+		if _, ok := s.Packages[p][a][v]; ok {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
 // Delete safely deletes a package from the Storage (if it's there)
 func (s *Storage) Delete(p *Package) {
 	s.mtx.Lock()
@@ -123,6 +240,28 @@ func (s *Storage) Delete(p *Package) {
 	delete(s.Packages[p.Platform][p.Android], p.Variant)
 }
 
+// migrate moves the deprecated fields of the cached packages to the actual ones
+// and builds the compatibility matrix missing in the old storages
+func (s *Storage) migrate(targets map[string]bool) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	var combos []gapps.Combo
+	for _, androids := range s.Packages {
+		for _, variants := range androids {
+			for _, p := range variants {
+				p.migrate(targets)
+				combos = append(combos, gapps.Combo{Platform: p.Platform, Android: p.Android, Variant: p.Variant})
+			}
+		}
+	}
+
+	// the storages saved before the compatibility matrix was introduced only know their packages
+	if s.Matrix == nil {
+		s.Matrix = gapps.NewMatrix(combos)
+	}
+}
+
 // Save saves the Storage to the cache
 func (s *Storage) Save() error {
 	s.mtx.RLock()
@@ -164,6 +303,7 @@ func getAllReleasesByTag(ctx context.Context, ghClient *github.Client, repo, tag
 		release  *github.RepositoryRelease
 		resp     *github.Response
 		count    int
+		missing  int
 		err      error
 	)
 	if tag == "" {
@@ -173,8 +313,14 @@ func getAllReleasesByTag(ctx context.Context, ghClient *github.Client, repo, tag
 	for _, platform := range gapps.PlatformValues() {
 		if tag == CurrentStorageKey {
 			release, resp, err = ghClient.Repositories.GetLatestRelease(ctx, repo, platform.String())
+			observeGithub("get_latest_release", resp, err)
 		} else {
 			release, resp, err = ghClient.Repositories.GetReleaseByTag(ctx, repo, platform.String(), tag)
+			observeGithub("get_release_by_tag", resp, err)
+		}
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			missing++
+			continue
 		}
 		if err != nil {
 			log.Errorf("Unable to get release from Github: %v", err)
@@ -193,7 +339,18 @@ func getAllReleasesByTag(ctx context.Context, ghClient *github.Client, repo, tag
 		count++
 	}
 	if count == 0 {
+		if missing == len(releases) {
+			return nil, fmt.Errorf("release %s is not found on Github: %w", tag, ErrStorageNotFound)
+		}
 		return nil, errors.New("no releases available")
 	}
-	return releases[:count-1], nil
+	return releases[:count], nil
+}
+
+// observeGithub records the Github API request metrics
+func observeGithub(method string, resp *github.Response, err error) {
+	metrics.GithubRequests.WithLabelValues(method, metrics.Result(err)).Inc()
+	if resp != nil && resp.Rate.Limit > 0 {
+		metrics.GithubRateRemaining.Set(float64(resp.Rate.Remaining))
+	}
 }
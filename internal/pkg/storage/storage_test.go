@@ -0,0 +1,93 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/nezorflame/opengapps-mirror-bot/pkg/gapps"
+
+	"github.com/google/go-github/v37/github"
+)
+
+// newTestGithub serves the releases of the platforms, except for the missing ones
+func newTestGithub(t *testing.T, missing map[string]bool) (*github.Client, func()) {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// /repos/{owner}/{platform}/releases/tags/{tag} or /repos/{owner}/{platform}/releases/latest
+		parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+		if len(parts) < 5 || missing[parts[2]] {
+			http.NotFound(w, r)
+			return
+		}
+		tag := parts[len(parts)-1]
+		if tag == "latest" {
+			tag = "20200101"
+		}
+		_ = json.NewEncoder(w).Encode(map[string]string{"name": parts[2], "tag_name": tag})
+	}))
+
+	u, err := url.Parse(srv.URL + "/")
+	if err != nil {
+		t.Fatalf("unable to parse Github URL: %v", err)
+	}
+	gh := github.NewClient(nil)
+	gh.BaseURL = u
+	return gh, srv.Close
+}
+
+func TestGetAllReleasesByTag(t *testing.T) {
+	platforms := gapps.PlatformValues()
+	last := platforms[len(platforms)-1].String()
+
+	tests := []struct {
+		name    string
+		tag     string
+		missing map[string]bool
+		want    int
+	}{
+		{"all platforms", "20200101", nil, len(platforms)},
+		{"latest", CurrentStorageKey, nil, len(platforms)},
+		{"missing platform", "20200101", map[string]bool{platforms[0].String(): true}, len(platforms) - 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gh, cleanup := newTestGithub(t, tt.missing)
+			defer cleanup()
+
+			releases, err := getAllReleasesByTag(context.Background(), gh, "opengapps", tt.tag)
+			if err != nil {
+				t.Fatalf("getAllReleasesByTag() returned error: %v", err)
+			}
+			if len(releases) != tt.want {
+				t.Fatalf("getAllReleasesByTag() returned %d releases, want %d", len(releases), tt.want)
+			}
+			// the release found last is returned as well
+			if name := releases[len(releases)-1].GetName(); name != last {
+				t.Errorf("last release is %s, want %s", name, last)
+			}
+			for _, r := range releases {
+				if r.GetTagName() != "20200101" {
+					t.Errorf("release %s has tag %s, want 20200101", r.GetName(), r.GetTagName())
+				}
+			}
+		})
+	}
+}
+
+func TestGetAllReleasesByTagMissing(t *testing.T) {
+	missing := make(map[string]bool)
+	for _, p := range gapps.PlatformValues() {
+		missing[p.String()] = true
+	}
+	gh, cleanup := newTestGithub(t, missing)
+	defer cleanup()
+
+	if releases, err := getAllReleasesByTag(context.Background(), gh, "opengapps", "20200102"); err == nil {
+		t.Errorf("getAllReleasesByTag() = %d releases, want error", len(releases))
+	}
+}
@@ -0,0 +1,121 @@
+package subscription
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/nezorflame/opengapps-mirror-bot/internal/pkg/db"
+	"github.com/nezorflame/opengapps-mirror-bot/pkg/gapps"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	bucketName   = "subscriptions"
+	keySeparator = ":"
+)
+
+// Subscription describes the chat subscription to the new releases of the package
+type Subscription struct {
+	ChatID   int64          `json:"chat_id"`
+	Platform gapps.Platform `json:"platform"`
+	Android  gapps.Android  `json:"android"`
+	Variant  gapps.Variant  `json:"variant"`
+	Locale   string         `json:"locale,omitempty"`
+}
+
+// Key returns the DB key for the subscription
+func (s *Subscription) Key() string {
+	return strings.Join([]string{strconv.FormatInt(s.ChatID, 10), s.Platform.String(), s.Android.String(), s.Variant.String()}, keySeparator)
+}
+
+// Store stores the subscriptions in the DB
+type Store struct {
+	bucket *db.Bucket
+}
+
+// NewStore creates a new Store instance
+func NewStore(cache *db.DB) (*Store, error) {
+	bucket, err := cache.Bucket(bucketName)
+	if err != nil {
+		return nil, fmt.Errorf("unable to init subscriptions bucket: %w", err)
+	}
+	return &Store{bucket: bucket}, nil
+}
+
+// Add saves the subscription
+func (s *Store) Add(sub *Subscription) error {
+	body, err := json.Marshal(sub)
+	if err != nil {
+		return fmt.Errorf("unable to marshal subscription: %w", err)
+	}
+	if err = s.bucket.Put(sub.Key(), body); err != nil {
+		return fmt.Errorf("unable to save subscription: %w", err)
+	}
+	return nil
+}
+
+// Remove deletes the subscription
+func (s *Store) Remove(sub *Subscription) error {
+	if err := s.bucket.Delete(sub.Key()); err != nil {
+		return fmt.Errorf("unable to delete subscription: %w", err)
+	}
+	return nil
+}
+
+// RemoveChat deletes all the subscriptions of the chat and returns their count
+func (s *Store) RemoveChat(chatID int64) (int, error) {
+	subs, err := s.ByChat(chatID)
+	if err != nil {
+		return 0, err
+	}
+	for _, sub := range subs {
+		if err = s.Remove(sub); err != nil {
+			return 0, err
+		}
+	}
+	return len(subs), nil
+}
+
+// ByChat returns all the subscriptions of the chat
+func (s *Store) ByChat(chatID int64) ([]*Subscription, error) {
+	subs, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*Subscription, 0, len(subs))
+	for _, sub := range subs {
+		if sub.ChatID == chatID {
+			result = append(result, sub)
+		}
+	}
+	return result, nil
+}
+
+// List returns all the subscriptions
+func (s *Store) List() ([]*Subscription, error) {
+	keys, err := s.bucket.Keys()
+	if err != nil {
+		return nil, fmt.Errorf("unable to get subscriptions: %w", err)
+	}
+
+	result := make([]*Subscription, 0, len(keys))
+	for _, k := range keys {
+		body, err := s.bucket.Get(k)
+		if err != nil {
+			log.Warnf("Unable to get subscription '%s': %v", k, err)
+			continue
+		}
+
+		sub := &Subscription{}
+		if err = json.Unmarshal(body, sub); err != nil {
+			log.Warnf("Unable to unmarshal subscription '%s': %v", k, err)
+			continue
+		}
+		result = append(result, sub)
+	}
+	return result, nil
+}
@@ -2,23 +2,44 @@ package main
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
+	"github.com/nezorflame/opengapps-mirror-bot/internal/pkg/bans"
 	"github.com/nezorflame/opengapps-mirror-bot/internal/pkg/config"
 	"github.com/nezorflame/opengapps-mirror-bot/internal/pkg/db"
+	"github.com/nezorflame/opengapps-mirror-bot/internal/pkg/health"
+	"github.com/nezorflame/opengapps-mirror-bot/internal/pkg/i18n"
+	"github.com/nezorflame/opengapps-mirror-bot/internal/pkg/jobs"
+	"github.com/nezorflame/opengapps-mirror-bot/internal/pkg/metrics"
+	"github.com/nezorflame/opengapps-mirror-bot/internal/pkg/server"
+	"github.com/nezorflame/opengapps-mirror-bot/internal/pkg/stats"
 	"github.com/nezorflame/opengapps-mirror-bot/internal/pkg/storage"
+	"github.com/nezorflame/opengapps-mirror-bot/internal/pkg/subscription"
+	"github.com/nezorflame/opengapps-mirror-bot/pkg/api"
+	"github.com/nezorflame/opengapps-mirror-bot/pkg/fileserver"
 	"github.com/nezorflame/opengapps-mirror-bot/pkg/net"
 	"github.com/nezorflame/opengapps-mirror-bot/pkg/telegram"
+	"github.com/nezorflame/opengapps-mirror-bot/pkg/upload"
 
 	"github.com/google/go-github/v37/github"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/pflag"
 	"golang.org/x/oauth2"
 )
 
+const (
+	shutdownTimeout = 5 * time.Second
+	pollMargin      = 30 * time.Second
+)
+
 var configName string
 
 func init() {
@@ -64,22 +85,147 @@ func main() {
 
 	// init download queue and cache
 	log.Info("Creating download queue")
-	dq := net.NewQueue(cfg.GetInt("max_downloads"))
+	dq := net.NewQueue(ctx, net.Options{
+		MaxDownloads: cfg.GetInt("max_downloads"),
+		Retries:      cfg.GetInt("download_retries"),
+		Chunks:       cfg.GetInt("download_chunks"),
+		Dir:          cfg.GetString("download_path"),
+		Observer:     metrics.Downloads{},
+	})
 	cache, err := db.NewDB(cfg.GetString("db.path"), cfg.GetDuration("db.timeout"))
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	// init mirror targets
+	log.Info("Creating mirror targets")
+	targets, err := upload.FromConfig(cfg)
+	if err != nil {
+		log.Fatalf("Unable to create mirror targets: %v", err)
+	}
+
 	// init GApps global storage
 	log.Info("Initiating GApps global storage")
 	gs := storage.NewGlobalStorage(cache)
-	if err = gs.Load(); err != nil {
+
+	// init health checks
+	var (
+		hc      = health.New()
+		renewed health.Heartbeat
+	)
+	hc.Ready("db", func() (string, error) { return "", cache.Ping() })
+	hc.Ready("renew", renewCheck(&renewed, 3*cfg.GetDuration("gapps.renew_period")))
+
+	// init HTTP server
+	var srv *server.Server
+	if addr := cfg.GetString("http.listen"); addr != "" {
+		srv = server.New(addr)
+		if cfg.GetBool("http.files.enabled") {
+			srv.Handle(cfg.GetString("http.files.prefix"), http.StripPrefix(
+				cfg.GetString("http.files.prefix"),
+				fileserver.New(cfg.GetString("http.files.root"), packageMD5(gs)),
+			))
+		}
+		if cfg.GetBool("http.metrics.enabled") {
+			registerMetrics(gs, cache)
+			srv.Handle(cfg.GetString("http.metrics.path"), promhttp.Handler())
+		}
+		if cfg.GetBool("http.health.enabled") {
+			srv.Handle("/healthz", http.HandlerFunc(hc.Healthz))
+			srv.Handle("/readyz", http.HandlerFunc(hc.Readyz))
+		}
+		if cfg.GetBool("http.api.enabled") {
+			srv.Handle(cfg.GetString("http.api.prefix"), http.StripPrefix(
+				strings.TrimSuffix(cfg.GetString("http.api.prefix"), "/"),
+				api.New(ctx, cfg, dq, targets, gs, gh),
+			))
+		}
+		srv.Start()
+	}
+
+	if err = gs.Load(targets); err != nil {
 		log.Fatalf("Unable to load the global storage from cache: %v", err)
 	}
 
-	if err = gs.AddLatestStorage(ctx, gh, dq, cfg); err != nil {
+	latest, added, err := gs.AddLatestStorage(ctx, gh, dq, cfg)
+	if err != nil {
 		log.Fatalf("Unable to add the latest storage: %v", err)
 	}
+	renewed.Beat()
+	hc.SetReady()
+
+	// init subscriptions store
+	log.Info("Initiating subscriptions store")
+	subs, err := subscription.NewStore(cache)
+	if err != nil {
+		log.Fatalf("Unable to init subscriptions store: %v", err)
+	}
+
+	// init request stats store
+	log.Info("Initiating request stats store")
+	st, err := stats.NewStore(cache)
+	if err != nil {
+		log.Fatalf("Unable to init request stats store: %v", err)
+	}
+
+	// init mirror jobs store
+	log.Info("Initiating mirror jobs store")
+	js, err := jobs.NewStore(cache)
+	if err != nil {
+		log.Fatalf("Unable to init mirror jobs store: %v", err)
+	}
+
+	// init banned users store
+	log.Info("Initiating banned users store")
+	bs, err := bans.NewStore(cache)
+	if err != nil {
+		log.Fatalf("Unable to init banned users store: %v", err)
+	}
+
+	// init message catalogs and user locales store
+	log.Info("Initiating message catalogs")
+	tr, err := i18n.New(cfg)
+	if err != nil {
+		log.Fatalf("Unable to init message catalogs: %v", err)
+	}
+	ls, err := i18n.NewStore(cache)
+	if err != nil {
+		log.Fatalf("Unable to init user locales store: %v", err)
+	}
+
+	// init release dates cache
+	log.Info("Initiating release dates cache")
+	rs, err := storage.NewReleases(cache, gh, cfg)
+	if err != nil {
+		log.Fatalf("Unable to init release dates cache: %v", err)
+	}
+
+	// create bot
+	bot, err := telegram.NewBot(ctx, cfg, telegram.Deps{
+		Queue:      dq,
+		Uploaders:  targets,
+		Storage:    gs,
+		Github:     gh,
+		Subs:       subs,
+		Stats:      st,
+		Jobs:       js,
+		Bans:       bs,
+		Translator: tr,
+		Locales:    ls,
+		Releases:   rs,
+		Observer:   metrics.Bot{},
+	})
+	if err != nil {
+		log.WithError(err).Fatal("Unable to create bot")
+	}
+	log.Info("Bot created")
+	hc.Live("telegram", pollCheck(bot, 2*time.Duration(cfg.GetInt("telegram.timeout"))*time.Second+pollMargin))
+	go bot.Resume()
+	if added {
+		// the release was published while the bot was down
+		log.Infof("Got the new release %s", latest.Date)
+		go bot.Release(latest)
+	}
 
 	// init package watcher
 	log.Info("Initiating GApps package watcher")
@@ -89,8 +235,15 @@ func main() {
 			select {
 			case <-ticker.C:
 				log.Info("Updating the current storage")
-				if err = gs.AddLatestStorage(ctx, gh, dq, cfg); err != nil {
+				s, added, err := gs.AddLatestStorage(ctx, gh, dq, cfg)
+				if err != nil {
 					log.Errorf("Unable to add the latest storage: %v", err)
+					continue
+				}
+				renewed.Beat()
+				if added {
+					log.Infof("Got the new release %s", s.Date)
+					go bot.Release(s)
 				}
 			case <-ctx.Done():
 				log.Warnf("Closing the watcher by context: %v", ctx.Err())
@@ -100,16 +253,26 @@ func main() {
 		}
 	}()
 
-	// create bot
-	bot, err := telegram.NewBot(ctx, cfg, dq, gs, gh)
-	if err != nil {
-		log.WithError(err).Fatal("Unable to create bot")
-	}
-	log.Info("Bot created")
+	// init expired mirrors sweeper
+	log.Info("Initiating expired mirrors sweeper")
+	go func() {
+		ticker := time.NewTicker(cfg.GetDuration("gapps.sweep_period"))
+		for {
+			select {
+			case <-ticker.C:
+				log.Debug("Sweeping the expired mirrors")
+				gs.Sweep(ctx, dq, cfg, targets)
+			case <-ctx.Done():
+				log.Warnf("Closing the sweeper by context: %v", ctx.Err())
+				ticker.Stop()
+				return
+			}
+		}
+	}()
 
 	// init graceful stop chan
 	log.Debug("Initiating system signal watcher")
-	var gracefulStop = make(chan os.Signal)
+	var gracefulStop = make(chan os.Signal, 1)
 	signal.Notify(gracefulStop, syscall.SIGTERM)
 	signal.Notify(gracefulStop, syscall.SIGINT)
 
@@ -118,6 +281,13 @@ func main() {
 		log.Warnf("Caught sig %+v, stopping the app", sig)
 		cancel()
 		bot.Stop()
+		if srv != nil {
+			stopCtx, stopCancel := context.WithTimeout(context.Background(), shutdownTimeout)
+			if err := srv.Stop(stopCtx); err != nil {
+				log.WithError(err).Error("Unable to stop HTTP server")
+			}
+			stopCancel()
+		}
 		gs.Save()
 		if err = cache.Close(false); err != nil {
 			log.WithError(err).Error("Unable to close DB")
@@ -127,5 +297,73 @@ func main() {
 
 	// start the bot
 	log.Info("Starting the bot")
-	bot.Start()
+	if err = bot.Start(); err != nil {
+		log.WithError(err).Fatal("Unable to start bot")
+	}
+}
+
+// renewCheck reports the age of the last successful storage renewal
+func renewCheck(renewed *health.Heartbeat, maxAge time.Duration) health.Check {
+	return func() (string, error) {
+		age, ok := renewed.Age()
+		if !ok {
+			return "", errors.New("storage was never renewed")
+		}
+		if age > maxAge {
+			return age.String(), fmt.Errorf("last renewal was %s ago", age.Round(time.Second))
+		}
+		return age.Round(time.Second).String(), nil
+	}
+}
+
+// pollCheck reports the age of the last successful Telegram long polling request or webhook check.
+// The check passes while the bot is not started yet, and fails if there was no successful poll for too long after the start.
+func pollCheck(bot *telegram.Bot, maxAge time.Duration) health.Check {
+	return func() (string, error) {
+		if age, ok := bot.PollAge(); ok {
+			if age > maxAge {
+				return age.String(), fmt.Errorf("last poll was %s ago", age.Round(time.Second))
+			}
+			return age.Round(time.Second).String(), nil
+		}
+
+		since, ok := bot.StartAge()
+		switch {
+		case !ok:
+			return "not started", nil
+		case since > maxAge:
+			return "never polled", fmt.Errorf("no successful poll since the start %s ago", since.Round(time.Second))
+		}
+		return "waiting for the first poll", nil
+	}
+}
+
+// registerMetrics registers the gauges for the storage and the DB state
+func registerMetrics(gs *storage.GlobalStorage, cache *db.DB) {
+	metrics.RegisterGauge("storages", "Number of the release storages.", func() float64 {
+		storages, _ := gs.Size()
+		return float64(storages)
+	})
+	metrics.RegisterGauge("packages", "Number of the packages in all the storages.", func() float64 {
+		_, packages := gs.Size()
+		return float64(packages)
+	})
+	metrics.RegisterGauge("db_size_bytes", "Size of the DB data.", func() float64 {
+		size, err := cache.Size()
+		if err != nil {
+			log.Errorf("Unable to get DB size: %v", err)
+		}
+		return float64(size)
+	})
+}
+
+// packageMD5 returns the lookup of the package MD5 checksums by their mirror paths
+func packageMD5(gs *storage.GlobalStorage) fileserver.LookupFunc {
+	return func(path string) (string, bool) {
+		p, ok := gs.PackageByPath(path)
+		if !ok {
+			return "", false
+		}
+		return p.MD5, true
+	}
 }
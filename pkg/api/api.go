@@ -0,0 +1,224 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/nezorflame/opengapps-mirror-bot/internal/pkg/storage"
+	"github.com/nezorflame/opengapps-mirror-bot/pkg/gapps"
+	"github.com/nezorflame/opengapps-mirror-bot/pkg/net"
+	"github.com/nezorflame/opengapps-mirror-bot/pkg/upload"
+
+	"github.com/google/go-github/v37/github"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+const bearerPrefix = "Bearer "
+
+var (
+	errNotFound     = errors.New("not found")
+	errBadRequest   = errors.New("bad request")
+	errUnauthorized = errors.New("unauthorized")
+)
+
+// API serves the JSON REST API over the GlobalStorage.
+// It should be mounted with http.StripPrefix, see README for the list of endpoints.
+type API struct {
+	ctx  context.Context
+	cfg  *viper.Viper
+	dq   *net.DownloadQueue
+	ups  []upload.Uploader
+	gs   *storage.GlobalStorage
+	gh   *github.Client
+	jobs *registry
+}
+
+// New creates a new API instance
+func New(ctx context.Context, cfg *viper.Viper, dq *net.DownloadQueue, ups []upload.Uploader, gs *storage.GlobalStorage, gh *github.Client) *API {
+	return &API{ctx: ctx, cfg: cfg, dq: dq, ups: ups, gs: gs, gh: gh, jobs: newRegistry()}
+}
+
+// ServeHTTP implements http.Handler
+func (a *API) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	log.WithField("method", r.Method).WithField("path", r.URL.Path).Debug("Got API request")
+
+	if !a.authorized(r) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="api"`)
+		writeError(w, http.StatusUnauthorized, errUnauthorized)
+		return
+	}
+
+	switch {
+	case len(parts) == 1 && parts[0] == "dates":
+		a.only(w, r, http.MethodGet, a.dates)
+	case len(parts) == 3 && parts[0] == "dates" && parts[2] == "packages":
+		a.only(w, r, http.MethodGet, func(w http.ResponseWriter, r *http.Request) { a.packages(w, r, parts[1]) })
+	case len(parts) == 6 && parts[0] == "dates" && parts[2] == "packages":
+		a.only(w, r, http.MethodGet, func(w http.ResponseWriter, r *http.Request) { a.pkg(w, r, parts[1], parts[3:]) })
+	case len(parts) == 7 && parts[0] == "dates" && parts[2] == "packages" && parts[6] == "mirror":
+		a.only(w, r, http.MethodPost, func(w http.ResponseWriter, r *http.Request) { a.mirror(w, r, parts[1], parts[3:6]) })
+	case len(parts) == 2 && parts[0] == "jobs":
+		a.only(w, r, http.MethodGet, func(w http.ResponseWriter, r *http.Request) { a.job(w, parts[1]) })
+	default:
+		writeError(w, http.StatusNotFound, errNotFound)
+	}
+}
+
+// authorized checks the bearer token of the request against 'http.api.token'
+func (a *API) authorized(r *http.Request) bool {
+	token := a.cfg.GetString("http.api.token")
+	got := strings.TrimPrefix(r.Header.Get("Authorization"), bearerPrefix)
+	return token != "" && subtle.ConstantTimeCompare([]byte(got), []byte(token)) == 1
+}
+
+func (a *API) only(w http.ResponseWriter, r *http.Request, method string, handler http.HandlerFunc) {
+	if r.Method != method {
+		w.Header().Set("Allow", method)
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s is not allowed", r.Method))
+		return
+	}
+	handler(w, r)
+}
+
+func (a *API) dates(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, a.gs.Dates())
+}
+
+func (a *API) packages(w http.ResponseWriter, r *http.Request, date string) {
+	s, err := a.storage(r.Context(), date)
+	if err != nil {
+		writeStorageError(w, err)
+		return
+	}
+
+	q := r.URL.Query()
+	platform, android, variant := q.Get("platform"), normalizeAndroid(q.Get("android")), q.Get("variant")
+	result := make([]*storage.Package, 0, s.Count)
+	for _, p := range s.List() {
+		if platform != "" && p.Platform.String() != platform ||
+			android != "" && p.Android.String() != android ||
+			variant != "" && p.Variant.String() != variant {
+			continue
+		}
+		result = append(result, p)
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (a *API) pkg(w http.ResponseWriter, r *http.Request, date string, parts []string) {
+	_, p, err := a.lookup(r.Context(), date, parts)
+	if err != nil {
+		writeStorageError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, p)
+}
+
+func (a *API) mirror(w http.ResponseWriter, r *http.Request, date string, parts []string) {
+	s, p, err := a.lookup(r.Context(), date, parts)
+	if err != nil {
+		writeStorageError(w, err)
+		return
+	}
+
+	j := a.jobs.add(s.Date, p)
+	go func() {
+		ctx, cancel := context.WithTimeout(a.ctx, a.cfg.GetDuration("gapps.mirror_timeout"))
+		defer cancel()
+
+		logger := log.WithField("job_id", j.ID).WithField("package", p.Name)
+		err := p.CreateMirror(ctx, a.dq, a.ups, nil)
+		if err != nil {
+			logger.Errorf("Unable to create mirror: %v", err)
+		} else if err = s.Save(); err != nil {
+			logger.Errorf("Unable to save storage: %v", err)
+		}
+		a.jobs.finish(j.ID, err)
+	}()
+
+	writeJSON(w, http.StatusAccepted, j)
+}
+
+func (a *API) job(w http.ResponseWriter, id string) {
+	j, ok := a.jobs.get(id)
+	if !ok {
+		writeError(w, http.StatusNotFound, errNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, j)
+}
+
+// storage returns the Storage for the release date, getting it from Github if it's unknown yet
+func (a *API) storage(ctx context.Context, date string) (*storage.Storage, error) {
+	if date != storage.CurrentStorageKey {
+		if _, err := time.Parse(a.cfg.GetString("gapps.time_format"), date); err != nil {
+			return nil, fmt.Errorf("%w: bad release date '%s'", errBadRequest, date)
+		}
+	}
+	if s, ok := a.gs.Get(date); ok {
+		return s, nil
+	}
+
+	s, err := storage.GetPackageStorage(ctx, a.gh, a.dq, a.cfg, date)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get package storage: %w", err)
+	}
+	return a.gs.AddIfMissing(s), nil
+}
+
+// lookup returns the package by the release date and its platform, Android version and variant
+func (a *API) lookup(ctx context.Context, date string, parts []string) (*storage.Storage, *storage.Package, error) {
+	platform, android, variant, err := gapps.ParsePackageParts([]string{parts[0], normalizeAndroid(parts[1]), parts[2]})
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", errBadRequest, err)
+	}
+
+	s, err := a.storage(ctx, date)
+	if err != nil {
+		return nil, nil, err
+	}
+	p, ok := s.Get(platform, android, variant)
+	if !ok {
+		return nil, nil, errNotFound
+	}
+	return s, p, nil
+}
+
+// normalizeAndroid allows to use both '9.0' and '90' as the Android version
+func normalizeAndroid(s string) string {
+	return strings.Replace(s, ".", "", -1)
+}
+
+func writeStorageError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errNotFound), errors.Is(err, storage.ErrStorageNotFound):
+		writeError(w, http.StatusNotFound, err)
+	case errors.Is(err, errBadRequest):
+		writeError(w, http.StatusBadRequest, err)
+	default:
+		log.Errorf("Unable to handle API request: %v", err)
+		writeError(w, http.StatusBadGateway, err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, struct {
+		Error string `json:"error"`
+	}{Error: err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Errorf("Unable to write API response: %v", err)
+	}
+}
@@ -0,0 +1,96 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/nezorflame/opengapps-mirror-bot/internal/pkg/storage"
+	"github.com/nezorflame/opengapps-mirror-bot/pkg/gapps"
+
+	"github.com/google/go-github/v37/github"
+	"github.com/spf13/viper"
+)
+
+const testToken = "secret"
+
+// newTestAPI creates the API with a single known release, the Github API is served at githubURL
+func newTestAPI(t *testing.T, githubURL string) *API {
+	t.Helper()
+
+	cfg := viper.New()
+	cfg.Set("http.api.token", testToken)
+	cfg.Set("gapps.time_format", "20060102")
+	cfg.Set("github.repo", "opengapps")
+
+	s := &storage.Storage{Packages: make(map[gapps.Platform]map[gapps.Android]map[gapps.Variant]*storage.Package)}
+	s.Add(&storage.Package{
+		Name:     "open_gapps-arm64-10.0-nano-20200101.zip",
+		Date:     "20200101",
+		Platform: gapps.PlatformArm64,
+		Android:  gapps.Android100,
+		Variant:  gapps.VariantNano,
+	})
+	gs := storage.NewGlobalStorage(nil)
+	gs.Add(s.Date, s)
+
+	return New(context.Background(), cfg, nil, nil, gs, newTestGithub(t, githubURL))
+}
+
+func newTestGithub(t *testing.T, rawurl string) *github.Client {
+	t.Helper()
+	u, err := url.Parse(rawurl + "/")
+	if err != nil {
+		t.Fatalf("unable to parse Github URL: %v", err)
+	}
+	gh := github.NewClient(nil)
+	gh.BaseURL = u
+	return gh
+}
+
+func TestServeHTTP(t *testing.T) {
+	notFound := func(w http.ResponseWriter, _ *http.Request) { http.NotFound(w, nil) }
+	failing := func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusInternalServerError) }
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		github http.HandlerFunc
+		status int
+	}{
+		{"no token", http.MethodGet, "/dates", "", notFound, http.StatusUnauthorized},
+		{"wrong token", http.MethodGet, "/dates", "wrong", notFound, http.StatusUnauthorized},
+		{"dates", http.MethodGet, "/dates", testToken, notFound, http.StatusOK},
+		{"known release", http.MethodGet, "/dates/20200101/packages", testToken, notFound, http.StatusOK},
+		{"known package", http.MethodGet, "/dates/20200101/packages/arm64/10.0/nano", testToken, notFound, http.StatusOK},
+		{"unknown package", http.MethodGet, "/dates/20200101/packages/arm64/10.0/pico", testToken, notFound, http.StatusNotFound},
+		{"bad package", http.MethodGet, "/dates/20200101/packages/arm64/10.0/huge", testToken, notFound, http.StatusBadRequest},
+		{"bad date", http.MethodGet, "/dates/2020-01-01/packages", testToken, notFound, http.StatusBadRequest},
+		{"unknown release", http.MethodGet, "/dates/20200102/packages", testToken, notFound, http.StatusNotFound},
+		{"Github failure", http.MethodGet, "/dates/20200102/packages", testToken, failing, http.StatusBadGateway},
+		{"bad method", http.MethodPost, "/dates", testToken, notFound, http.StatusMethodNotAllowed},
+		{"unknown job", http.MethodGet, "/jobs/42", testToken, notFound, http.StatusNotFound},
+		{"unknown path", http.MethodGet, "/releases", testToken, notFound, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(tt.github)
+			defer srv.Close()
+
+			a := newTestAPI(t, srv.URL)
+			r := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.token != "" {
+				r.Header.Set("Authorization", bearerPrefix+tt.token)
+			}
+			w := httptest.NewRecorder()
+			a.ServeHTTP(w, r)
+			if w.Code != tt.status {
+				t.Errorf("%s %s = %d, want %d: %s", tt.method, tt.path, w.Code, tt.status, w.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/nezorflame/opengapps-mirror-bot/internal/pkg/storage"
+	"github.com/nezorflame/opengapps-mirror-bot/pkg/gapps"
+)
+
+// finished jobs are kept for polling during jobTTL
+const jobTTL = time.Hour
+
+// JobState describes the state of the API mirror job
+type JobState string
+
+// JobState consts
+const (
+	JobRunning JobState = "running"
+	JobDone    JobState = "done"
+	JobFailed  JobState = "failed"
+)
+
+// Job describes the mirror job started by the API
+type Job struct {
+	ID         string           `json:"id"`
+	Date       string           `json:"date"`
+	Platform   gapps.Platform   `json:"platform"`
+	Android    gapps.Android    `json:"android"`
+	Variant    gapps.Variant    `json:"variant"`
+	State      JobState         `json:"state"`
+	Error      string           `json:"error,omitempty"`
+	Package    *storage.Package `json:"package,omitempty"`
+	CreatedAt  time.Time        `json:"created_at"`
+	FinishedAt *time.Time       `json:"finished_at,omitempty"`
+}
+
+// registry keeps the API jobs in memory
+type registry struct {
+	jobs map[string]*Job
+	mtx  sync.Mutex
+}
+
+func newRegistry() *registry {
+	return &registry{jobs: make(map[string]*Job)}
+}
+
+// add registers the new running job for the package and returns its copy
+func (r *registry) add(date string, p *storage.Package) Job {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.purge()
+
+	j := &Job{
+		ID:        newID(),
+		Date:      date,
+		Platform:  p.Platform,
+		Android:   p.Android,
+		Variant:   p.Variant,
+		State:     JobRunning,
+		Package:   p,
+		CreatedAt: time.Now(),
+	}
+	r.jobs[j.ID] = j
+	return *j
+}
+
+// finish sets the job result
+func (r *registry) finish(id string, err error) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	j, ok := r.jobs[id]
+	if !ok {
+		return
+	}
+	now := time.Now()
+	j.State, j.FinishedAt = JobDone, &now
+	if err != nil {
+		j.State, j.Error = JobFailed, err.Error()
+	}
+}
+
+// get returns the copy of the job
+func (r *registry) get(id string) (Job, bool) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	j, ok := r.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	return *j, true
+}
+
+// purge removes the jobs finished more than jobTTL ago
+func (r *registry) purge() {
+	for id, j := range r.jobs {
+		if j.FinishedAt != nil && time.Since(*j.FinishedAt) > jobTTL {
+			delete(r.jobs, id)
+		}
+	}
+}
+
+func newID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,147 @@
+package fileserver
+
+import (
+	"html/template"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const defaultContentType = "application/octet-stream"
+
+// contentTypes are used for the extensions which may be missing in the system MIME types
+var contentTypes = map[string]string{
+	".zip": "application/zip",
+	".md5": "text/plain; charset=utf-8",
+}
+
+// LookupFunc returns the MD5 checksum of the file by its relative slash-separated path
+type LookupFunc func(path string) (md5 string, ok bool)
+
+// Handler serves the files of the mirror directory with the generated directory index
+type Handler struct {
+	root   string
+	lookup LookupFunc
+}
+
+// New creates a new Handler for the root directory.
+// Lookup is optional and is used to set the file ETag to its known MD5 checksum.
+func New(root string, lookup LookupFunc) *Handler {
+	return &Handler{root: root, lookup: lookup}
+}
+
+// ServeHTTP implements http.Handler
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	// cleaning the rooted path prevents escaping the root directory
+	rel := path.Clean("/" + r.URL.Path)
+	full := filepath.Join(h.root, filepath.FromSlash(rel))
+	info, err := os.Stat(full)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	if info.IsDir() {
+		// the root is requested with the empty path behind http.StripPrefix, it never needs a redirect
+		if rel != "/" && !strings.HasSuffix(r.URL.Path, "/") {
+			// relative redirect keeps the prefix the handler may be mounted with
+			w.Header().Set("Location", "./"+path.Base(rel)+"/")
+			w.WriteHeader(http.StatusMovedPermanently)
+			return
+		}
+		h.index(w, full, rel)
+		return
+	}
+
+	file, err := os.Open(full)
+	if err != nil {
+		log.Errorf("Unable to open the file '%s': %v", full, err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	defer file.Close()
+
+	if h.lookup != nil {
+		if md5, ok := h.lookup(strings.TrimPrefix(rel, "/")); ok {
+			w.Header().Set("ETag", `"`+md5+`"`)
+		}
+	}
+	w.Header().Set("Content-Type", contentType(info.Name()))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": info.Name()}))
+
+	// ServeContent handles the Range and conditional requests
+	http.ServeContent(w, r, info.Name(), info.ModTime(), file)
+}
+
+type indexEntry struct {
+	Name    string
+	Size    int64
+	ModTime string
+	IsDir   bool
+}
+
+var indexTemplate = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Index of {{.Path}}</title></head>
+<body>
+<h1>Index of {{.Path}}</h1>
+<table>
+<tr><th>Name</th><th>Size</th><th>Modified</th></tr>
+{{if ne .Path "/"}}<tr><td><a href="../">../</a></td><td></td><td></td></tr>{{end}}
+{{range .Entries}}<tr><td><a href="{{.Name}}{{if .IsDir}}/{{end}}">{{.Name}}{{if .IsDir}}/{{end}}</a></td><td>{{if not .IsDir}}{{.Size}}{{end}}</td><td>{{.ModTime}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// index writes the generated index of the directory
+func (h *Handler) index(w http.ResponseWriter, dir, rel string) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		log.Errorf("Unable to read the directory '%s': %v", dir, err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	entries := make([]indexEntry, 0, len(files))
+	for _, f := range files {
+		entries = append(entries, indexEntry{
+			Name:    f.Name(),
+			Size:    f.Size(),
+			ModTime: f.ModTime().UTC().Format(http.TimeFormat),
+			IsDir:   f.IsDir(),
+		})
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	data := struct {
+		Path    string
+		Entries []indexEntry
+	}{Path: rel, Entries: entries}
+	if err = indexTemplate.Execute(w, data); err != nil {
+		log.Errorf("Unable to write the directory index: %v", err)
+	}
+}
+
+func contentType(name string) string {
+	ext := strings.ToLower(filepath.Ext(name))
+	if t, ok := contentTypes[ext]; ok {
+		return t
+	}
+	if t := mime.TypeByExtension(ext); t != "" {
+		return t
+	}
+	return defaultContentType
+}
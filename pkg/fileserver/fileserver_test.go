@@ -0,0 +1,123 @@
+package fileserver
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testMD5 = "0123456789abcdef0123456789abcdef"
+
+var testZip = bytes.Repeat([]byte("0123456789"), 100)
+
+func newTestHandler(t *testing.T) (*Handler, func()) {
+	t.Helper()
+	root, err := ioutil.TempDir("", "fileserver-test")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	dir := filepath.Join(root, "arm64", "20200101")
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("unable to create dir: %v", err)
+	}
+	if err = ioutil.WriteFile(filepath.Join(dir, "nano.zip"), testZip, 0644); err != nil {
+		t.Fatalf("unable to write file: %v", err)
+	}
+	if err = ioutil.WriteFile(filepath.Join(root, "secret.txt"), []byte("secret"), 0644); err != nil {
+		t.Fatalf("unable to write file: %v", err)
+	}
+
+	h := New(root, func(path string) (string, bool) {
+		if path == "arm64/20200101/nano.zip" {
+			return testMD5, true
+		}
+		return "", false
+	})
+	return h, func() { _ = os.RemoveAll(root) }
+}
+
+func TestServeHTTP(t *testing.T) {
+	h, cleanup := newTestHandler(t)
+	defer cleanup()
+
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		headers map[string]string
+		status  int
+		body    string
+		etag    string
+		// location of the redirect
+		location string
+	}{
+		{name: "file", method: http.MethodGet, path: "/arm64/20200101/nano.zip", status: http.StatusOK, body: string(testZip), etag: `"` + testMD5 + `"`},
+		{name: "head", method: http.MethodHead, path: "/arm64/20200101/nano.zip", status: http.StatusOK, etag: `"` + testMD5 + `"`},
+		{
+			name:    "range",
+			method:  http.MethodGet,
+			path:    "/arm64/20200101/nano.zip",
+			headers: map[string]string{"Range": "bytes=10-19"},
+			status:  http.StatusPartialContent,
+			body:    string(testZip[10:20]),
+			etag:    `"` + testMD5 + `"`,
+		},
+		{
+			name:    "range of the same file",
+			method:  http.MethodGet,
+			path:    "/arm64/20200101/nano.zip",
+			headers: map[string]string{"Range": "bytes=0-9", "If-Range": `"` + testMD5 + `"`},
+			status:  http.StatusPartialContent,
+			body:    string(testZip[:10]),
+		},
+		{
+			name:    "range of the changed file",
+			method:  http.MethodGet,
+			path:    "/arm64/20200101/nano.zip",
+			headers: map[string]string{"Range": "bytes=0-9", "If-Range": `"other"`},
+			status:  http.StatusOK,
+			body:    string(testZip),
+		},
+		{
+			name:    "not modified",
+			method:  http.MethodGet,
+			path:    "/arm64/20200101/nano.zip",
+			headers: map[string]string{"If-None-Match": `"` + testMD5 + `"`},
+			status:  http.StatusNotModified,
+		},
+		{name: "unknown checksum", method: http.MethodGet, path: "/secret.txt", status: http.StatusOK, body: "secret"},
+		{name: "index", method: http.MethodGet, path: "/arm64/20200101/", status: http.StatusOK, body: `<a href="nano.zip">`},
+		{name: "dir redirect", method: http.MethodGet, path: "/arm64", status: http.StatusMovedPermanently, location: "./arm64/"},
+		{name: "escape", method: http.MethodGet, path: "/../../etc/passwd", status: http.StatusNotFound},
+		{name: "missing", method: http.MethodGet, path: "/arm64/20200102/nano.zip", status: http.StatusNotFound},
+		{name: "bad method", method: http.MethodPost, path: "/arm64/20200101/nano.zip", status: http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.path, nil)
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			if w.Code != tt.status {
+				t.Fatalf("%s %s = %d, want %d", tt.method, tt.path, w.Code, tt.status)
+			}
+			if !strings.Contains(w.Body.String(), tt.body) {
+				t.Errorf("body = %q, want %q", w.Body, tt.body)
+			}
+			if tt.etag != "" && w.Header().Get("ETag") != tt.etag {
+				t.Errorf("ETag = %s, want %s", w.Header().Get("ETag"), tt.etag)
+			}
+			if tt.location != "" && w.Header().Get("Location") != tt.location {
+				t.Errorf("Location = %s, want %s", w.Header().Get("Location"), tt.location)
+			}
+		})
+	}
+}
@@ -0,0 +1,199 @@
+package gapps
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// Combo is the platform, Android version and variant combination of the package
+type Combo struct {
+	Platform Platform `json:"platform"`
+	Android  Android  `json:"android"`
+	Variant  Variant  `json:"variant"`
+}
+
+// String returns the human-readable combination
+func (c Combo) String() string {
+	return fmt.Sprintf("%s %s %s", c.Platform, c.Android.HumanString(), c.Variant)
+}
+
+// Reason describes why the combination is not built
+type Reason string
+
+// Reason consts
+const (
+	// ReasonPlatform means that the platform is not built at all
+	ReasonPlatform Reason = "platform"
+	// ReasonAndroid means that the platform is not built for the Android version
+	ReasonAndroid Reason = "android"
+	// ReasonVariant means that the variant is not built for the platform
+	ReasonVariant Reason = "variant"
+	// ReasonCombination means that the variant is built for the platform, but not for the Android version
+	ReasonCombination Reason = "combination"
+)
+
+// CompatError describes the combination which is not built
+type CompatError struct {
+	Combo  Combo
+	Reason Reason
+	// Closest is the closest available combination, nil if there's none
+	Closest *Combo
+}
+
+func (e *CompatError) Error() string {
+	var reason string
+	switch e.Reason {
+	case ReasonPlatform:
+		reason = fmt.Sprintf("platform %s is not built", e.Combo.Platform)
+	case ReasonAndroid:
+		reason = fmt.Sprintf("platform %s is not built for Android %s", e.Combo.Platform, e.Combo.Android.HumanString())
+	case ReasonVariant:
+		reason = fmt.Sprintf("variant %s is not built for platform %s", e.Combo.Variant, e.Combo.Platform)
+	default:
+		reason = fmt.Sprintf("variant %s is not built for platform %s on Android %s", e.Combo.Variant, e.Combo.Platform, e.Combo.Android.HumanString())
+	}
+	return fmt.Sprintf("combination '%s' is not available: %s", e.Combo, reason)
+}
+
+// Matrix is the compatibility model of a release: the package combinations built for it.
+// It's immutable once created and is safe for concurrent use.
+type Matrix struct {
+	combos []Combo
+	set    map[Combo]struct{}
+}
+
+// NewMatrix creates the Matrix from the observed combinations, ignoring the duplicates
+func NewMatrix(combos []Combo) *Matrix {
+	m := &Matrix{set: make(map[Combo]struct{}, len(combos))}
+	for _, c := range combos {
+		if _, ok := m.set[c]; ok {
+			continue
+		}
+		m.set[c] = struct{}{}
+		m.combos = append(m.combos, c)
+	}
+	sort.Slice(m.combos, func(i, j int) bool {
+		a, b := m.combos[i], m.combos[j]
+		if a.Platform != b.Platform {
+			return a.Platform < b.Platform
+		}
+		if a.Android != b.Android {
+			return a.Android < b.Android
+		}
+		return a.Variant < b.Variant
+	})
+	return m
+}
+
+// Len returns the number of the combinations in the Matrix
+func (m *Matrix) Len() int {
+	return len(m.combos)
+}
+
+// Combos returns the combinations in the Matrix, ordered by the platform, Android version and variant
+func (m *Matrix) Combos() []Combo {
+	result := make([]Combo, len(m.combos))
+	copy(result, m.combos)
+	return result
+}
+
+// Has checks if the combination is built
+func (m *Matrix) Has(c Combo) bool {
+	_, ok := m.set[c]
+	return ok
+}
+
+// Androids returns the Android versions for which the variant is built for the platform
+func (m *Matrix) Androids(p Platform, v Variant) []Android {
+	var result []Android
+	for _, c := range m.combos {
+		if c.Platform == p && c.Variant == v {
+			result = append(result, c.Android)
+		}
+	}
+	return result
+}
+
+// Check returns *CompatError describing why the combination is not built, or nil if it is
+func (m *Matrix) Check(c Combo) error {
+	if m.Has(c) {
+		return nil
+	}
+
+	var platform, android, variant bool
+	for _, o := range m.combos {
+		if o.Platform != c.Platform {
+			continue
+		}
+		platform = true
+		android = android || o.Android == c.Android
+		variant = variant || o.Variant == c.Variant
+	}
+
+	err := &CompatError{Combo: c, Reason: ReasonCombination}
+	switch {
+	case !platform:
+		err.Reason = ReasonPlatform
+	case !android:
+		err.Reason = ReasonAndroid
+	case !variant:
+		err.Reason = ReasonVariant
+	}
+	if closest, ok := m.Closest(c); ok {
+		err.Closest = &closest
+	}
+	return err
+}
+
+// Closest returns the closest built combination: the same platform is preferred over the other ones,
+// then the same or the nearest variant, then the nearest Android version (the newer one on ties)
+func (m *Matrix) Closest(c Combo) (Combo, bool) {
+	var (
+		best      Combo
+		bestScore []int
+	)
+	for _, o := range m.combos {
+		score := []int{
+			abs(int(o.Platform) - int(c.Platform)),
+			abs(int(o.Variant) - int(c.Variant)),
+			abs(int(o.Android) - int(c.Android)),
+			-int(o.Android),
+		}
+		if bestScore == nil || less(score, bestScore) {
+			best, bestScore = o, score
+		}
+	}
+	return best, bestScore != nil
+}
+
+// MarshalJSON marshals the Matrix as the list of combinations
+func (m *Matrix) MarshalJSON() ([]byte, error) {
+	return json.Marshal(m.combos)
+}
+
+// UnmarshalJSON unmarshals the Matrix from the list of combinations
+func (m *Matrix) UnmarshalJSON(data []byte) error {
+	var combos []Combo
+	if err := json.Unmarshal(data, &combos); err != nil {
+		return fmt.Errorf("unable to unmarshal compatibility matrix: %w", err)
+	}
+	*m = *NewMatrix(combos)
+	return nil
+}
+
+func less(a, b []int) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+	return false
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
@@ -0,0 +1,176 @@
+package gapps
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+var testCombos = []Combo{
+	{PlatformArm64, Android100, VariantNano},
+	{PlatformArm64, Android100, VariantPico},
+	{PlatformArm64, Android90, VariantFull},
+	{PlatformArm, Android90, VariantNano},
+	// duplicates are ignored
+	{PlatformArm64, Android100, VariantNano},
+}
+
+func TestNewMatrix(t *testing.T) {
+	m := NewMatrix(testCombos)
+	if m.Len() != 4 {
+		t.Errorf("Len() = %d, want 4", m.Len())
+	}
+	for _, c := range testCombos {
+		if !m.Has(c) {
+			t.Errorf("Has(%s) = false, want true", c)
+		}
+	}
+	if c := (Combo{PlatformX86, Android100, VariantNano}); m.Has(c) {
+		t.Errorf("Has(%s) = true, want false", c)
+	}
+}
+
+func TestMatrixCombos(t *testing.T) {
+	want := []Combo{
+		{PlatformArm, Android90, VariantNano},
+		{PlatformArm64, Android90, VariantFull},
+		{PlatformArm64, Android100, VariantPico},
+		{PlatformArm64, Android100, VariantNano},
+	}
+	got := NewMatrix(testCombos).Combos()
+	if len(got) != len(want) {
+		t.Fatalf("Combos() = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Combos()[%d] = %s, want %s", i, got[i], want[i])
+		}
+	}
+}
+
+func TestMatrixCheck(t *testing.T) {
+	m := NewMatrix(testCombos)
+	tests := []struct {
+		name    string
+		combo   Combo
+		reason  Reason
+		closest Combo
+	}{
+		{"missing platform", Combo{PlatformX86, Android100, VariantNano}, ReasonPlatform, Combo{PlatformArm64, Android100, VariantNano}},
+		{"missing android", Combo{PlatformArm64, Android110, VariantNano}, ReasonAndroid, Combo{PlatformArm64, Android100, VariantNano}},
+		{"missing variant", Combo{PlatformArm64, Android100, VariantStock}, ReasonVariant, Combo{PlatformArm64, Android90, VariantFull}},
+		{"missing combination", Combo{PlatformArm64, Android90, VariantNano}, ReasonCombination, Combo{PlatformArm64, Android100, VariantNano}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ce *CompatError
+			if err := m.Check(tt.combo); !errors.As(err, &ce) {
+				t.Fatalf("Check(%s) = %v, want *CompatError", tt.combo, err)
+			}
+			if ce.Reason != tt.reason {
+				t.Errorf("Check(%s) reason = %s, want %s", tt.combo, ce.Reason, tt.reason)
+			}
+			if ce.Closest == nil || *ce.Closest != tt.closest {
+				t.Errorf("Check(%s) closest = %v, want %s", tt.combo, ce.Closest, tt.closest)
+			}
+		})
+	}
+
+	for _, c := range testCombos {
+		if err := m.Check(c); err != nil {
+			t.Errorf("Check(%s) = %v, want nil", c, err)
+		}
+	}
+}
+
+func TestMatrixCheckEmpty(t *testing.T) {
+	var ce *CompatError
+	c := Combo{PlatformArm64, Android100, VariantNano}
+	if err := NewMatrix(nil).Check(c); !errors.As(err, &ce) {
+		t.Fatalf("Check(%s) = %v, want *CompatError", c, err)
+	}
+	if ce.Reason != ReasonPlatform || ce.Closest != nil {
+		t.Errorf("Check(%s) = %+v, want platform reason without the closest combination", c, *ce)
+	}
+}
+
+func TestMatrixClosest(t *testing.T) {
+	tests := []struct {
+		name   string
+		combos []Combo
+		combo  Combo
+		want   Combo
+		ok     bool
+	}{
+		{
+			name:   "empty",
+			combos: nil,
+			combo:  Combo{PlatformArm64, Android100, VariantNano},
+			ok:     false,
+		},
+		{
+			name:   "exact",
+			combos: testCombos,
+			combo:  Combo{PlatformArm64, Android90, VariantFull},
+			want:   Combo{PlatformArm64, Android90, VariantFull},
+			ok:     true,
+		},
+		{
+			name: "same platform over same variant",
+			combos: []Combo{
+				{PlatformArm, Android100, VariantNano},
+				{PlatformArm64, Android100, VariantFull},
+			},
+			combo: Combo{PlatformArm64, Android100, VariantNano},
+			want:  Combo{PlatformArm64, Android100, VariantFull},
+			ok:    true,
+		},
+		{
+			name: "nearest variant over nearest android",
+			combos: []Combo{
+				{PlatformArm64, Android100, VariantFull},
+				{PlatformArm64, Android44, VariantPico},
+			},
+			combo: Combo{PlatformArm64, Android100, VariantNano},
+			want:  Combo{PlatformArm64, Android44, VariantPico},
+			ok:    true,
+		},
+		{
+			name: "newer android on ties",
+			combos: []Combo{
+				{PlatformArm64, Android90, VariantNano},
+				{PlatformArm64, Android110, VariantNano},
+			},
+			combo: Combo{PlatformArm64, Android100, VariantNano},
+			want:  Combo{PlatformArm64, Android110, VariantNano},
+			ok:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := NewMatrix(tt.combos).Closest(tt.combo)
+			if ok != tt.ok || ok && got != tt.want {
+				t.Errorf("Closest(%s) = %s, %t, want %s, %t", tt.combo, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestMatrixJSON(t *testing.T) {
+	body, err := json.Marshal(NewMatrix(testCombos))
+	if err != nil {
+		t.Fatalf("unable to marshal matrix: %v", err)
+	}
+	m := &Matrix{}
+	if err = json.Unmarshal(body, m); err != nil {
+		t.Fatalf("unable to unmarshal matrix: %v", err)
+	}
+	for _, c := range testCombos {
+		if !m.Has(c) {
+			t.Errorf("unmarshalled matrix is missing %s", c)
+		}
+	}
+	if m.Len() != 4 {
+		t.Errorf("unmarshalled Len() = %d, want 4", m.Len())
+	}
+}
@@ -0,0 +1,317 @@
+package gapps
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Part is the kind of the package argument
+type Part string
+
+// Part consts
+const (
+	PartPlatform Part = "platform"
+	PartAndroid  Part = "android"
+	PartVariant  Part = "variant"
+	PartDate     Part = "date"
+	// PartArgs is used for the extra and repeated arguments
+	PartArgs Part = "args"
+)
+
+// minDateLength is the length of the shortest digit-only argument treated as a date
+const minDateLength = 5
+
+// platformAliases are the alternative names of the platforms, e.g. Android ABIs
+var platformAliases = map[string]Platform{
+	"armeabi":     PlatformArm,
+	"armeabi-v7a": PlatformArm,
+	"armv7":       PlatformArm,
+	"arm32":       PlatformArm,
+	"arm64-v8a":   PlatformArm64,
+	"armv8":       PlatformArm64,
+	"aarch64":     PlatformArm64,
+	"x86-64":      PlatformX86_64,
+	"x64":         PlatformX86_64,
+	"amd64":       PlatformX86_64,
+	"i386":        PlatformX86,
+	"i686":        PlatformX86,
+}
+
+// androidAliases are the code names of the Android versions, only the ones naming a single version
+var androidAliases = map[string]Android{
+	"kitkat":      Android44,
+	"marshmallow": Android60,
+	"pie":         Android90,
+	"p":           Android90,
+	"q":           Android100,
+	"r":           Android110,
+}
+
+// latestAliases are the dates meaning the latest release
+var latestAliases = []string{"latest", "current"}
+
+// todayAlias is the date meaning the release of the current day
+const todayAlias = "today"
+
+// androidPrefix is allowed before the Android version, e.g. "Android 10" or "android10"
+const androidPrefix = "android"
+
+// Query describes the package arguments parsed by Parse. The parts which weren't provided are nil.
+type Query struct {
+	Platform *Platform
+	Android  *Android
+	Variant  *Variant
+	// Date is the release date, empty for the latest release
+	Date string
+}
+
+// Package returns the package parts of the query, failing if any of them is missing
+func (q *Query) Package() (Platform, Android, Variant, error) {
+	switch {
+	case q.Platform == nil:
+		return 0, 0, 0, &ParseError{Part: PartPlatform}
+	case q.Android == nil:
+		return 0, 0, 0, &ParseError{Part: PartAndroid}
+	case q.Variant == nil:
+		return 0, 0, 0, &ParseError{Part: PartVariant}
+	}
+	return *q.Platform, *q.Android, *q.Variant, nil
+}
+
+// ParseError describes the package argument which couldn't be parsed
+type ParseError struct {
+	Part Part
+	// Arg is the bad argument, empty if the part is missing
+	Arg string
+	// Suggestion is the closest known value for the argument, if there's one
+	Suggestion string
+}
+
+func (e *ParseError) Error() string {
+	switch {
+	case e.Arg == "":
+		return fmt.Sprintf("missing %s", e.Part)
+	case e.Part == PartArgs:
+		return fmt.Sprintf("unexpected argument '%s'", e.Arg)
+	case e.Suggestion != "":
+		return fmt.Sprintf("unknown %s '%s', did you mean '%s'?", e.Part, e.Arg, e.Suggestion)
+	}
+	return fmt.Sprintf("unknown %s '%s'", e.Part, e.Arg)
+}
+
+// word is the known spelling of the package part value
+type word struct {
+	part  Part
+	value uint
+	// canonical is the value name shown in the suggestions
+	canonical string
+}
+
+// dictionary holds all the known spellings of the platforms, Android versions and variants
+var dictionary = newDictionary()
+
+func newDictionary() map[string]word {
+	d := make(map[string]word)
+	for _, p := range PlatformValues() {
+		d[p.String()] = word{PartPlatform, uint(p), p.String()}
+	}
+	for alias, p := range platformAliases {
+		d[alias] = word{PartPlatform, uint(p), p.String()}
+	}
+	for _, a := range AndroidValues() {
+		w := word{PartAndroid, uint(a), a.HumanString()}
+		d[a.String()], d[a.HumanString()] = w, w
+		if major := strings.TrimSuffix(a.HumanString(), ".0"); major != a.HumanString() {
+			d[major] = w
+		}
+	}
+	for alias, a := range androidAliases {
+		d[alias] = word{PartAndroid, uint(a), a.HumanString()}
+	}
+	for _, v := range VariantValues() {
+		d[v.String()] = word{PartVariant, uint(v), v.String()}
+	}
+	return d
+}
+
+// Parse parses the package arguments: platform, Android version, variant and release date in any order.
+// The common aliases are accepted, e.g. "arm64-v8a", "Android 10", "Q" or "latest".
+// The unknown arguments are reported with *ParseError, suggesting the closest known value.
+func Parse(args []string, timeFormat string) (*Query, error) {
+	q := &Query{}
+	dateSet := false
+	tokens := strings.FieldsFunc(strings.ToLower(strings.Join(args, " ")), func(r rune) bool {
+		return unicode.IsSpace(r) || r == ','
+	})
+	for _, t := range tokens {
+		if t != androidPrefix && strings.HasPrefix(t, androidPrefix) {
+			t = strings.TrimPrefix(strings.TrimPrefix(t, androidPrefix), "-")
+		}
+
+		var date string
+		switch {
+		case t == androidPrefix:
+			continue
+		case t == todayAlias:
+			date = time.Now().UTC().Format(timeFormat)
+		case isLatest(t):
+		case isDate(t, timeFormat):
+			date = t
+		default:
+			if err := q.set(t); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if dateSet {
+			return nil, &ParseError{Part: PartArgs, Arg: t}
+		}
+		q.Date, dateSet = date, true
+	}
+	return q, nil
+}
+
+// set sets the query part described by the token
+func (q *Query) set(t string) error {
+	w, ok := dictionary[t]
+	if !ok {
+		return unknownArg(t)
+	}
+
+	switch w.part {
+	case PartPlatform:
+		if q.Platform != nil {
+			return &ParseError{Part: PartArgs, Arg: t}
+		}
+		p := Platform(w.value)
+		q.Platform = &p
+	case PartAndroid:
+		if q.Android != nil {
+			return &ParseError{Part: PartArgs, Arg: t}
+		}
+		a := Android(w.value)
+		q.Android = &a
+	case PartVariant:
+		if q.Variant != nil {
+			return &ParseError{Part: PartArgs, Arg: t}
+		}
+		v := Variant(w.value)
+		q.Variant = &v
+	}
+	return nil
+}
+
+// unknownArg returns the error for the unknown token, suggesting the closest known value
+func unknownArg(t string) *ParseError {
+	if isDigits(t) && len(t) >= minDateLength {
+		return &ParseError{Part: PartDate, Arg: t}
+	}
+
+	// allow a single typo in the short words and two in the longer ones, but never replace the whole word
+	maxDistance := 1
+	if len(t) > 4 {
+		maxDistance = 2
+	}
+	if l := len([]rune(t)); maxDistance >= l {
+		maxDistance = l - 1
+	}
+
+	var (
+		best         *word
+		bestSpelling string
+		bestDistance = maxDistance + 1
+	)
+	for spelling, w := range dictionary {
+		d := distance(t, spelling)
+		if d < bestDistance || d == bestDistance && best != nil && closer(t, spelling, w, bestSpelling, *best) {
+			w := w
+			best, bestSpelling, bestDistance = &w, spelling, d
+		}
+	}
+	if best == nil {
+		return &ParseError{Part: PartArgs, Arg: t}
+	}
+	return &ParseError{Part: best.part, Arg: t, Suggestion: best.canonical}
+}
+
+// closer breaks the tie between two spellings: the value names win over the aliases,
+// then the longer common prefix wins, then the first one in the alphabetical order, to keep the suggestions stable
+func closer(t, a string, wa word, b string, wb word) bool {
+	if ca, cb := a == wa.canonical, b == wb.canonical; ca != cb {
+		return ca
+	}
+	if pa, pb := commonPrefix(t, a), commonPrefix(t, b); pa != pb {
+		return pa > pb
+	}
+	return a < b
+}
+
+func commonPrefix(a, b string) int {
+	n := 0
+	for n < len(a) && n < len(b) && a[n] == b[n] {
+		n++
+	}
+	return n
+}
+
+// distance returns the edit distance between the strings, counting the adjacent transpositions as a single edit
+func distance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	d := make([][]int, len(ra)+1)
+	for i := range d {
+		d[i] = make([]int, len(rb)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			d[i][j] = min(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				d[i][j] = min(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(ra)][len(rb)]
+}
+
+func min(values ...int) int {
+	result := values[0]
+	for _, v := range values[1:] {
+		if v < result {
+			result = v
+		}
+	}
+	return result
+}
+
+func isLatest(t string) bool {
+	for _, a := range latestAliases {
+		if t == a {
+			return true
+		}
+	}
+	return false
+}
+
+func isDate(t, timeFormat string) bool {
+	_, err := time.Parse(timeFormat, t)
+	return err == nil
+}
+
+func isDigits(t string) bool {
+	for _, r := range t {
+		if !unicode.IsDigit(r) {
+			return false
+		}
+	}
+	return t != ""
+}
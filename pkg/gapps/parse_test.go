@@ -0,0 +1,172 @@
+package gapps
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+const testTimeFormat = "20060102"
+
+func TestParse(t *testing.T) {
+	var (
+		arm64  = PlatformArm64
+		x86_64 = PlatformX86_64
+		a90    = Android90
+		a100   = Android100
+		nano   = VariantNano
+		full   = VariantFull
+	)
+	tests := []struct {
+		name string
+		args []string
+		want Query
+	}{
+		{"canonical", []string{"arm64", "10.0", "nano"}, Query{Platform: &arm64, Android: &a100, Variant: &nano}},
+		{"any order", []string{"nano", "20200101", "10.0", "arm64"}, Query{Platform: &arm64, Android: &a100, Variant: &nano, Date: "20200101"}},
+		{"single argument", []string{"arm64 10.0 nano"}, Query{Platform: &arm64, Android: &a100, Variant: &nano}},
+		{"commas", []string{"arm64,10.0,", "nano"}, Query{Platform: &arm64, Android: &a100, Variant: &nano}},
+		{"case", []string{"ARM64", "Nano"}, Query{Platform: &arm64, Variant: &nano}},
+		{"ABI alias", []string{"arm64-v8a"}, Query{Platform: &arm64}},
+		{"arch alias", []string{"amd64", "full"}, Query{Platform: &x86_64, Variant: &full}},
+		{"short version", []string{"10"}, Query{Android: &a100}},
+		{"enum version", []string{"100"}, Query{Android: &a100}},
+		{"android prefix", []string{"Android", "10"}, Query{Android: &a100}},
+		{"joined android prefix", []string{"android10"}, Query{Android: &a100}},
+		{"dashed android prefix", []string{"android-9.0"}, Query{Android: &a90}},
+		{"code name", []string{"Q"}, Query{Android: &a100}},
+		{"long code name", []string{"pie"}, Query{Android: &a90}},
+		{"latest", []string{"latest"}, Query{}},
+		{"current", []string{"current", "nano"}, Query{Variant: &nano}},
+		{"empty", nil, Query{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.args, testTimeFormat)
+			if err != nil {
+				t.Fatalf("Parse(%q) returned error: %v", tt.args, err)
+			}
+			if !equalQuery(*got, tt.want) {
+				t.Errorf("Parse(%q) = %s, want %s", tt.args, queryString(*got), queryString(tt.want))
+			}
+		})
+	}
+}
+
+func TestParseToday(t *testing.T) {
+	got, err := Parse([]string{"today"}, testTimeFormat)
+	if err != nil {
+		t.Fatalf("Parse(today) returned error: %v", err)
+	}
+	if want := time.Now().UTC().Format(testTimeFormat); got.Date != want {
+		t.Errorf("Parse(today).Date = %q, want %q", got.Date, want)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want ParseError
+	}{
+		{"repeated platform", []string{"arm64", "arm"}, ParseError{Part: PartArgs, Arg: "arm"}},
+		{"repeated android", []string{"10.0", "q"}, ParseError{Part: PartArgs, Arg: "q"}},
+		{"repeated variant", []string{"nano", "pico"}, ParseError{Part: PartArgs, Arg: "pico"}},
+		{"repeated date", []string{"20200101", "latest"}, ParseError{Part: PartArgs, Arg: "latest"}},
+		{"unknown word", []string{"xyz"}, ParseError{Part: PartArgs, Arg: "xyz"}},
+		{"bad date", []string{"20201350"}, ParseError{Part: PartDate, Arg: "20201350"}},
+		{"typo", []string{"nanno"}, ParseError{Part: PartVariant, Arg: "nanno", Suggestion: "nano"}},
+		{"transposition", []string{"arm46"}, ParseError{Part: PartPlatform, Arg: "arm46", Suggestion: "arm64"}},
+		{"two typos", []string{"tvmim"}, ParseError{Part: PartVariant, Arg: "tvmim", Suggestion: "tvmini"}},
+		{"alias typo", []string{"ktkat"}, ParseError{Part: PartAndroid, Arg: "ktkat", Suggestion: "4.4"}},
+		{"version typo", []string{"10.1"}, ParseError{Part: PartAndroid, Arg: "10.1", Suggestion: "10.0"}},
+		// the tie-breaks: the value names first, then the longer common prefix, then the alphabetical order
+		{"value name over alias", []string{"x85"}, ParseError{Part: PartPlatform, Arg: "x85", Suggestion: "x86"}},
+		{"longer common prefix", []string{"arm6"}, ParseError{Part: PartPlatform, Arg: "arm6", Suggestion: "arm64"}},
+		{"alphabetical order", []string{"91"}, ParseError{Part: PartAndroid, Arg: "91", Suggestion: "9.0"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.args, testTimeFormat)
+			var pe *ParseError
+			if !errors.As(err, &pe) {
+				t.Fatalf("Parse(%q) error = %v, want *ParseError", tt.args, err)
+			}
+			if *pe != tt.want {
+				t.Errorf("Parse(%q) error = %+v, want %+v", tt.args, *pe, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueryPackage(t *testing.T) {
+	tests := []struct {
+		args    []string
+		missing Part
+	}{
+		{[]string{"arm64", "10.0", "nano"}, ""},
+		{[]string{"10.0", "nano"}, PartPlatform},
+		{[]string{"arm64", "nano"}, PartAndroid},
+		{[]string{"arm64", "10.0"}, PartVariant},
+	}
+	for _, tt := range tests {
+		q, err := Parse(tt.args, testTimeFormat)
+		if err != nil {
+			t.Fatalf("Parse(%q) returned error: %v", tt.args, err)
+		}
+		_, _, _, err = q.Package()
+		var pe *ParseError
+		switch {
+		case tt.missing == "" && err != nil:
+			t.Errorf("Package() of %q returned error: %v", tt.args, err)
+		case tt.missing != "" && (!errors.As(err, &pe) || pe.Part != tt.missing || pe.Arg != ""):
+			t.Errorf("Package() of %q error = %v, want missing %s", tt.args, err, tt.missing)
+		}
+	}
+}
+
+func TestDistance(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"nano", "nano", 0},
+		{"", "nano", 4},
+		{"nano", "", 4},
+		{"nano", "nana", 1},
+		{"nano", "nanno", 1},
+		{"nano", "nao", 1},
+		{"arm64", "arm46", 1},
+		{"micro", "mirco", 1},
+		{"pico", "nano", 3},
+	}
+	for _, tt := range tests {
+		if got := distance(tt.a, tt.b); got != tt.want {
+			t.Errorf("distance(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func equalQuery(a, b Query) bool {
+	return a.Date == b.Date &&
+		(a.Platform == nil) == (b.Platform == nil) && (a.Platform == nil || *a.Platform == *b.Platform) &&
+		(a.Android == nil) == (b.Android == nil) && (a.Android == nil || *a.Android == *b.Android) &&
+		(a.Variant == nil) == (b.Variant == nil) && (a.Variant == nil || *a.Variant == *b.Variant)
+}
+
+func queryString(q Query) string {
+	s := "{"
+	if q.Platform != nil {
+		s += " platform=" + q.Platform.String()
+	}
+	if q.Android != nil {
+		s += " android=" + q.Android.HumanString()
+	}
+	if q.Variant != nil {
+		s += " variant=" + q.Variant.String()
+	}
+	if q.Date != "" {
+		s += " date=" + q.Date
+	}
+	return s + " }"
+}
@@ -0,0 +1,50 @@
+package net
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+)
+
+// Checksums describes the checksums of the downloaded file
+type Checksums struct {
+	MD5    string
+	SHA1   string
+	SHA256 string
+}
+
+// hasher calculates all the checksums of the data written to it
+type hasher struct {
+	md5    hash.Hash
+	sha1   hash.Hash
+	sha256 hash.Hash
+	w      io.Writer
+}
+
+func newHasher() *hasher {
+	h := &hasher{md5: md5.New(), sha1: sha1.New(), sha256: sha256.New()}
+	h.w = io.MultiWriter(h.md5, h.sha1, h.sha256)
+	return h
+}
+
+func (h *hasher) Write(p []byte) (int, error) {
+	return h.w.Write(p)
+}
+
+// Reset discards the data written so far
+func (h *hasher) Reset() {
+	h.md5.Reset()
+	h.sha1.Reset()
+	h.sha256.Reset()
+}
+
+func (h *hasher) sums() Checksums {
+	return Checksums{
+		MD5:    hex.EncodeToString(h.md5.Sum(nil)),
+		SHA1:   hex.EncodeToString(h.sha1.Sum(nil)),
+		SHA256: hex.EncodeToString(h.sha256.Sum(nil)),
+	}
+}
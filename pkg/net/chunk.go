@@ -0,0 +1,155 @@
+package net
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	chunkSuffix  = ".part"
+	resultSuffix = ".download"
+)
+
+var errRangeNotSupported = errors.New("range requests are not supported")
+
+// chunk describes the part of the file downloaded with a range request
+type chunk struct {
+	index int
+	start int64 // first byte of the chunk
+	end   int64 // first byte after the chunk
+	path  string
+}
+
+// splitChunks splits the file into at least one and at most limit chunks, but never more than its size
+func splitChunks(base string, size int64, limit int) []*chunk {
+	if int64(limit) > size {
+		limit = int(size)
+	}
+	if limit < 1 {
+		limit = 1
+	}
+
+	chunks := make([]*chunk, limit)
+	lenSub, diff := size/int64(limit), size%int64(limit)
+	for i := 0; i < limit; i++ {
+		min, max := lenSub*int64(i), lenSub*int64(i+1)
+		if i == limit-1 {
+			max += diff // Add the remaining bytes in the last request
+		}
+		chunks[i] = &chunk{index: i, start: min, end: max, path: base + "." + strconv.Itoa(i) + chunkSuffix}
+	}
+	return chunks
+}
+
+func (c *chunk) size() int64 {
+	return c.end - c.start
+}
+
+// resume checks the chunk file left from the previous download and returns its valid size
+func (c *chunk) resume() int {
+	info, err := os.Stat(c.path)
+	if err != nil {
+		return 0
+	}
+	if info.Size() > c.size() {
+		log.Warnf("Chunk file %s is bigger than expected, removing it", c.path)
+		_ = os.Remove(c.path)
+		return 0
+	}
+	if info.Size() > 0 {
+		log.Debugf("Resuming chunk %d from %d bytes", c.index, info.Size())
+	}
+	return int(info.Size())
+}
+
+// download downloads the remaining part of the chunk, appending it to the chunk file and reporting the received bytes to obs
+func (c *chunk) download(ctx context.Context, url string, t *tracker, obs Observer) error {
+	file, err := os.OpenFile(c.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("unable to open chunk file: %w", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("unable to get chunk file info: %w", err)
+	}
+	remaining := c.size() - info.Size()
+	if remaining == 0 {
+		return nil
+	}
+	from, to := c.start+info.Size(), c.end-1
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("unable to create request: %w", err)
+	}
+	req.Header.Add("Range", "bytes="+strconv.FormatInt(from, 10)+"-"+strconv.FormatInt(to, 10))
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("unable to make request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+	case http.StatusOK:
+		return errRangeNotSupported
+	default:
+		return fmt.Errorf("bad response status: %s", resp.Status)
+	}
+
+	if err = checkContentRange(resp.Header.Get("Content-Range"), from, to); err != nil {
+		return err
+	}
+	if resp.ContentLength >= 0 && resp.ContentLength != remaining {
+		return fmt.Errorf("bad content length: want %d, got %d", remaining, resp.ContentLength)
+	}
+
+	n, err := io.CopyN(file, trackReader(countReader{resp.Body, obs}, t), remaining)
+	if err != nil {
+		return fmt.Errorf("unable to write chunk file (%d of %d bytes written): %w", n, remaining, err)
+	}
+	return nil
+}
+
+// removeChunks removes all the chunk files of the failed download
+func removeChunks(chunks []*chunk) {
+	for _, c := range chunks {
+		if err := os.Remove(c.path); err != nil && !os.IsNotExist(err) {
+			log.Warnf("Unable to remove chunk file %s: %v", c.path, err)
+		}
+	}
+}
+
+// checkContentRange validates the 'Content-Range: bytes from-to/total' header
+func checkContentRange(header string, from, to int64) error {
+	parts := strings.SplitN(strings.TrimPrefix(header, "bytes "), "/", 2)
+	bounds := strings.SplitN(parts[0], "-", 2)
+	if len(bounds) != 2 {
+		return fmt.Errorf("bad content range '%s'", header)
+	}
+
+	start, err := strconv.ParseInt(bounds[0], 10, 64)
+	if err != nil {
+		return fmt.Errorf("bad content range '%s': %w", header, err)
+	}
+	end, err := strconv.ParseInt(bounds[1], 10, 64)
+	if err != nil {
+		return fmt.Errorf("bad content range '%s': %w", header, err)
+	}
+
+	if start != from || end != to {
+		return fmt.Errorf("content range mismatch: want %d-%d, got %d-%d", from, to, start, end)
+	}
+	return nil
+}
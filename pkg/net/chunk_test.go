@@ -0,0 +1,67 @@
+package net
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestSplitChunks(t *testing.T) {
+	tests := []struct {
+		name  string
+		size  int64
+		limit int
+		// want is the list of the chunk bounds, end exclusive
+		want [][2]int64
+	}{
+		{"even", 100, 4, [][2]int64{{0, 25}, {25, 50}, {50, 75}, {75, 100}}},
+		{"remainder in the last chunk", 10, 3, [][2]int64{{0, 3}, {3, 6}, {6, 10}}},
+		{"single", 10, 1, [][2]int64{{0, 10}}},
+		{"zero limit", 10, 0, [][2]int64{{0, 10}}},
+		{"negative limit", 10, -2, [][2]int64{{0, 10}}},
+		{"limit over size", 3, 8, [][2]int64{{0, 1}, {1, 2}, {2, 3}}},
+		{"empty file", 0, 4, [][2]int64{{0, 0}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunks := splitChunks("file", tt.size, tt.limit)
+			if len(chunks) != len(tt.want) {
+				t.Fatalf("splitChunks(%d, %d) returned %d chunks, want %d", tt.size, tt.limit, len(chunks), len(tt.want))
+			}
+			for i, c := range chunks {
+				if c.index != i || c.start != tt.want[i][0] || c.end != tt.want[i][1] {
+					t.Errorf("chunk %d = #%d %d-%d, want #%d %d-%d", i, c.index, c.start, c.end, i, tt.want[i][0], tt.want[i][1])
+				}
+				if want := "file." + strconv.Itoa(i) + chunkSuffix; c.path != want {
+					t.Errorf("chunk %d path = %s, want %s", i, c.path, want)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckContentRange(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   string
+		from, to int64
+		ok       bool
+	}{
+		{"valid", "bytes 0-99/1000", 0, 99, true},
+		{"valid with unknown total", "bytes 100-199/*", 100, 199, true},
+		{"valid without total", "bytes 100-199", 100, 199, true},
+		{"start mismatch", "bytes 0-199/1000", 100, 199, false},
+		{"end mismatch", "bytes 100-150/1000", 100, 199, false},
+		{"empty", "", 0, 99, false},
+		{"no bounds", "bytes */1000", 0, 99, false},
+		{"bad start", "bytes a-99/1000", 0, 99, false},
+		{"bad end", "bytes 0-b/1000", 0, 99, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkContentRange(tt.header, tt.from, tt.to)
+			if (err == nil) != tt.ok {
+				t.Errorf("checkContentRange(%q, %d, %d) = %v, want ok %t", tt.header, tt.from, tt.to, err, tt.ok)
+			}
+		})
+	}
+}
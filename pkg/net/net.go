@@ -1,134 +1,342 @@
 package net
 
 import (
-	"crypto/md5"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"os"
+	"path/filepath"
 	"strconv"
 	"sync"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 )
 
+const (
+	defaultDirName = "opengapps-mirror-bot"
+	minBackoff     = time.Second
+	maxBackoff     = 30 * time.Second
+)
+
+// Options describes the DownloadQueue settings
+type Options struct {
+	// MaxDownloads is the number of the concurrent downloads
+	MaxDownloads int
+	// Retries is the number of the retries of each failed request, made with exponential backoff
+	Retries int
+	// Chunks is the number of the chunks of the multi-threaded downloads
+	Chunks int
+	// Dir keeps the chunks of the multi-threaded downloads (system temp folder by default)
+	Dir string
+	// Observer receives the queue events (optional)
+	Observer Observer
+}
+
 // DownloadQueue is used to limit download process
 type DownloadQueue struct {
-	tokens chan struct{}
+	ctx     context.Context
+	tokens  chan struct{}
+	retries int
+	chunks  int
+	backoff time.Duration
+	dir     string
+	obs     Observer
 }
 
-// NewQueue creates a new instance of DownloadQueue
-func NewQueue(maxCount int) *DownloadQueue {
+// NewQueue creates a new instance of DownloadQueue.
+// The ctx is the lifetime of the whole app: the chunks of the downloads aborted by its cancellation
+// are kept, so that they are resumed after the restart, while the failed downloads start from scratch.
+func NewQueue(ctx context.Context, opts Options) *DownloadQueue {
+	if opts.Dir == "" {
+		opts.Dir = filepath.Join(os.TempDir(), defaultDirName)
+	}
+	if opts.Observer == nil {
+		opts.Observer = nopObserver{}
+	}
+	opts.Observer.QueueCapacity(opts.MaxDownloads)
 	return &DownloadQueue{
-		tokens: make(chan struct{}, maxCount),
+		ctx:     ctx,
+		tokens:  make(chan struct{}, opts.MaxDownloads),
+		retries: opts.Retries,
+		chunks:  opts.Chunks,
+		backoff: minBackoff,
+		dir:     opts.Dir,
+		obs:     opts.Observer,
 	}
 }
 
 // AddSingle gets a file from URL in single thread
-func (dq *DownloadQueue) AddSingle(url string) (string, error) {
-	dq.acquire()
-	defer dq.release()
-
-	resp, err := http.DefaultClient.Get(url)
-	if err != nil {
-		return "", fmt.Errorf("unable to make GET request: %w", err)
-	}
-	defer resp.Body.Close()
-
-	tmpFile, err := createTmpFile(resp.Body)
-	if err != nil {
-		return "", fmt.Errorf("unable to create result file: %w", err)
-	}
-
-	return tmpFile.Name(), nil
+func (dq *DownloadQueue) AddSingle(ctx context.Context, url string) (string, error) {
+	start := time.Now()
+	result, err := dq.single(ctx, url, 0, nil, nil)
+	dq.obs.Finished(ModeSingle, time.Since(start), err)
+	return result, err
 }
 
-// AddMultiple gets the file from URL in multiple threads
-func (dq *DownloadQueue) AddMultiple(url, md5sum string, limit, size int) (string, error) {
+// AddMultiple gets the file from URL in multiple threads (one per chunk) and returns its path along with its checksums.
+// If the server doesn't support range requests, the file is downloaded in single thread.
+// The checksums of the single-threaded download are calculated as the file is written, while the chunks
+// are hashed when they're joined (see joinFiles). The MD5 one is verified if md5sum is set.
+// Progress is optional and is reported for both download and verification.
+// If the context is done, the download is aborted, see NewQueue for the chunks kept.
+func (dq *DownloadQueue) AddMultiple(ctx context.Context, url, md5sum string, size int, progress ProgressFunc) (string, Checksums, error) {
 	var (
 		result string
 		err    error
+		t      *tracker
+		h      = newHasher()
+		mode   = ModeMulti
+		start  = time.Now()
+		limit  = dq.chunks
 	)
+	defer func() {
+		dq.obs.Finished(mode, time.Since(start), err)
+	}()
+
+	if limit < 1 {
+		limit = 1
+	}
 
 	switch {
 	case size > 0:
-		if result, err = dq.multi(url, size, limit); err != nil {
-			return "", errors.New("unable to download the file")
+		if progress != nil {
+			t = newTracker(StageDownload, int64(size), limit, progress)
+		}
+		result, err = dq.multi(ctx, url, int64(size), limit, t, h)
+		if errors.Is(err, errRangeNotSupported) {
+			log.Warnf("Falling back to single thread download: %v", err)
+			mode = ModeSingle
+			if progress != nil {
+				t = newTracker(StageDownload, int64(size), 1, progress)
+			}
+			result, err = dq.single(ctx, url, int64(size), t, h)
+		}
+		if err != nil {
+			return "", Checksums{}, fmt.Errorf("unable to download the file: %w", err)
 		}
 	case size == 0:
-		if result, err = dq.AddSingle(url); err != nil {
-			return "", errors.New("unable to download the file")
+		mode = ModeSingle
+		if progress != nil {
+			t = newTracker(StageDownload, 0, 1, progress)
+		}
+		if result, err = dq.single(ctx, url, 0, t, h); err != nil {
+			return "", Checksums{}, fmt.Errorf("unable to download the file: %w", err)
 		}
 	default:
-		return "", errors.New("file size must be more than 0")
+		err = errors.New("file size must be more than 0")
+		return "", Checksums{}, err
 	}
 
-	if md5sum != "" {
-		if check, err := checkMD5(result, md5sum); err != nil {
-			return "", fmt.Errorf("unable to check MD5 checksum: %w", err)
-		} else if !check {
-			return "", errors.New("checksum mismatch")
+	sums := h.sums()
+	if md5sum != "" && sums.MD5 != md5sum {
+		dq.obs.ChecksumMismatch()
+		_ = os.Remove(result)
+		err = errors.New("checksum mismatch")
+		return "", Checksums{}, err
+	}
+
+	return result, sums, nil
+}
+
+// single downloads the file in one request, writing its content to the hasher (if set).
+// The file is checked against the expected size (if set) and the response Content-Length.
+func (dq *DownloadQueue) single(ctx context.Context, url string, size int64, t *tracker, h *hasher) (string, error) {
+	if err := dq.acquire(ctx); err != nil {
+		return "", err
+	}
+	defer dq.release()
+
+	t.setChunk(0, ChunkActive)
+	var result string
+	err := dq.retry(ctx, func() error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return fmt.Errorf("unable to create request: %w", err)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return fmt.Errorf("unable to make GET request: %w", err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("bad response status: %s", resp.Status)
+		}
+		want := size
+		if want <= 0 {
+			want = resp.ContentLength
+		}
+
+		// the previous attempt may have read a part of the body
+		t.resetDone()
+		var body io.Reader = trackReader(countReader{resp.Body, dq.obs}, t)
+		if h != nil {
+			h.Reset()
+			body = io.TeeReader(body, h)
+		}
+		tmpFile, err := createTmpFile(body)
+		if err != nil {
+			return fmt.Errorf("unable to create result file: %w", err)
 		}
+		defer tmpFile.Close()
+
+		info, err := tmpFile.Stat()
+		if err != nil {
+			_ = os.Remove(tmpFile.Name())
+			return fmt.Errorf("unable to get result file info: %w", err)
+		}
+		if want >= 0 && info.Size() != want {
+			_ = os.Remove(tmpFile.Name())
+			return fmt.Errorf("bad file size: want %d, got %d", want, info.Size())
+		}
+		result = tmpFile.Name()
+		return nil
+	})
+	if err != nil {
+		t.setChunk(0, ChunkFailed)
+		return "", err
 	}
+	t.setChunk(0, ChunkDone)
 
 	return result, nil
 }
 
-func (dq *DownloadQueue) multi(url string, size, limit int) (string, error) {
-	dq.acquire()
+// multi downloads the file in chunks, writing its content to the hasher while the chunks are joined
+func (dq *DownloadQueue) multi(ctx context.Context, url string, size int64, limit int, t *tracker, h *hasher) (string, error) {
+	if err := dq.acquire(ctx); err != nil {
+		return "", err
+	}
 	defer dq.release()
 
-	var wg sync.WaitGroup
-	wg.Add(limit)
-	lenSub, diff := size/limit, size%limit
-	tmpFileNames := make([]string, limit)
-	for i := 0; i < limit; i++ {
-		min, max := lenSub*i, lenSub*(i+1)
-		if i == limit-1 {
-			max += diff // Add the remaining bytes in the last request
-		}
-
-		go func(min, max, i int) {
-			req, _ := http.NewRequest(http.MethodGet, url, nil)
-			rangeHeader := "bytes=" + strconv.Itoa(min) + "-" + strconv.Itoa(max-1)
-			req.Header.Add("Range", rangeHeader)
-
-			resp, err := http.DefaultClient.Do(req)
-			if err != nil {
-				log.Errorf("Unable to make request: %v", err)
-				return
-			}
-			defer resp.Body.Close()
+	if err := os.MkdirAll(dq.dir, 0755); err != nil {
+		return "", fmt.Errorf("unable to create download folder: %w", err)
+	}
+
+	base := dq.basePath(url, size, limit)
+	chunks := splitChunks(base, size, limit)
+	errs := make(chan error, len(chunks))
 
-			tmpFile, err := createTmpFile(resp.Body)
-			if err != nil {
-				log.Errorf("Unable to make temp file: %v", err)
+	var wg sync.WaitGroup
+	wg.Add(len(chunks))
+	for _, c := range chunks {
+		go func(c *chunk) {
+			defer wg.Done()
+			t.add(c.resume())
+			t.setChunk(c.index, ChunkActive)
+			if err := dq.retry(ctx, func() error { return c.download(ctx, url, t, dq.obs) }); err != nil {
+				t.setChunk(c.index, ChunkFailed)
+				errs <- fmt.Errorf("unable to download chunk %d: %w", c.index, err)
 				return
 			}
-
-			tmpFileNames[i] = tmpFile.Name()
-			tmpFile.Close()
-			wg.Done()
-		}(min, max, i)
+			t.setChunk(c.index, ChunkDone)
+		}(c)
 	}
 	wg.Wait()
+	close(errs)
+
+	// the chunks are kept for resuming only if the download is aborted by the shutdown (or the process dies),
+	// the failed or cancelled download (including the one falling back to single thread) starts from scratch
+	if err := <-errs; err != nil {
+		if dq.stopping(err) {
+			log.Debugf("Download is aborted by shutdown, keeping the chunks of %s", base)
+		} else {
+			removeChunks(chunks)
+		}
+		return "", err
+	}
 
-	tmpFileName, err := joinFiles(tmpFileNames)
+	paths := make([]string, len(chunks))
+	for i := range chunks {
+		paths[i] = chunks[i].path
+	}
+	t.setStage(StageVerify)
+	result, err := joinFiles(paths, h)
 	if err != nil {
+		removeChunks(chunks)
 		return "", fmt.Errorf("unable to create result file: %w", err)
 	}
 
-	return tmpFileName, nil
+	// rename the result, so that it's never mistaken for the first chunk
+	if err = os.Rename(result, base+resultSuffix); err != nil {
+		return "", fmt.Errorf("unable to rename result file: %w", err)
+	}
+	return base + resultSuffix, nil
 }
 
-func (dq *DownloadQueue) acquire() {
-	dq.tokens <- struct{}{}
+// retry calls fn until it succeeds, the retry budget is exceeded or the context is done,
+// with exponential backoff between the attempts
+func (dq *DownloadQueue) retry(ctx context.Context, fn func() error) error {
+	var (
+		backoff = dq.backoff
+		err     error
+	)
+	for attempt := 0; attempt <= dq.retries; attempt++ {
+		if attempt > 0 {
+			log.Warnf("Attempt %d failed, retrying in %s: %v", attempt, backoff, err)
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				return fmt.Errorf("download aborted: %w", ctx.Err())
+			}
+			if backoff *= 2; backoff > maxBackoff {
+				backoff = maxBackoff
+			}
+		}
+
+		if err = fn(); err == nil || errors.Is(err, errRangeNotSupported) {
+			return err
+		}
+		if ctx.Err() != nil {
+			return fmt.Errorf("download aborted: %w", ctx.Err())
+		}
+	}
+	return fmt.Errorf("retry budget exceeded: %w", err)
+}
+
+// stopping checks if the download error is caused by the shutdown
+func (dq *DownloadQueue) stopping(err error) bool {
+	return errors.Is(err, context.Canceled) && dq.ctx.Err() != nil
+}
+
+// basePath returns the unique path prefix for the download files
+func (dq *DownloadQueue) basePath(url string, size int64, limit int) string {
+	hash := sha1.Sum([]byte(url + "#" + strconv.FormatInt(size, 10) + "#" + strconv.Itoa(limit)))
+	return filepath.Join(dq.dir, hex.EncodeToString(hash[:]))
+}
+
+func (dq *DownloadQueue) acquire(ctx context.Context) error {
+	start := time.Now()
+	select {
+	case dq.tokens <- struct{}{}:
+		dq.obs.Acquired(time.Since(start))
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("download aborted while waiting in queue: %w", ctx.Err())
+	}
 }
 
 func (dq *DownloadQueue) release() {
 	<-dq.tokens
+	dq.obs.Released()
+}
+
+// countReader reports the downloaded bytes to the observer
+type countReader struct {
+	r   io.Reader
+	obs Observer
+}
+
+func (cr countReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.obs.Downloaded(n)
+	return n, err
 }
 
 func createTmpFile(content io.Reader) (*os.File, error) {
@@ -140,33 +348,41 @@ func createTmpFile(content io.Reader) (*os.File, error) {
 	if content != nil {
 		if _, err = io.Copy(file, content); err != nil {
 			file.Close()
+			_ = os.Remove(file.Name())
 			return nil, fmt.Errorf("unable to write file content: %w", err)
 		}
 	}
 	return file, nil
 }
 
-func joinFiles(filepaths []string) (string, error) {
+// joinFiles appends all the files to the first one, removing them.
+// The whole content of the result is written to h in a single pass.
+//
+// The chunks are hashed here rather than while they're downloaded: the hashes need the data in order,
+// while the chunks arrive concurrently and may be resumed from the files of the previous run.
+// The join reads every appended chunk once anyway, so only the first one is read just for hashing.
+func joinFiles(filepaths []string, h io.Writer) (string, error) {
 	if len(filepaths) <= 0 {
 		return "", errors.New("nothing to merge")
 	}
 
-	if len(filepaths) == 1 {
-		return filepaths[0], nil
-	}
-
-	dest, err := os.OpenFile(filepaths[0], os.O_APPEND|os.O_WRONLY, 0644)
+	dest, err := os.OpenFile(filepaths[0], os.O_APPEND|os.O_RDWR, 0644)
 	if err != nil {
 		return "", fmt.Errorf("unable to open destination file: %w", err)
 	}
 	defer dest.Close()
 
+	// the appended data is hashed while it's copied, so only the first file is read separately
+	if _, err = io.Copy(h, dest); err != nil {
+		return "", fmt.Errorf("unable to read destination file: %w", err)
+	}
+
 	var source *os.File
 	for i := 1; i < len(filepaths); i++ {
 		if source, err = os.Open(filepaths[i]); err != nil {
 			return "", fmt.Errorf("unable to open destination file: %w", err)
 		}
-		_, err := io.Copy(dest, source)
+		_, err := io.Copy(io.MultiWriter(dest, h), source)
 		_ = source.Close()
 		_ = os.Remove(filepaths[i])
 		if err != nil {
@@ -175,19 +391,3 @@ func joinFiles(filepaths []string) (string, error) {
 	}
 	return filepaths[0], nil
 }
-
-func checkMD5(path, md5sum string) (bool, error) {
-	file, err := os.Open(path)
-	if err != nil {
-		return false, fmt.Errorf("unable to open the file: %w", err)
-	}
-	defer file.Close()
-
-	content, err := ioutil.ReadAll(file)
-	if err != nil {
-		return false, fmt.Errorf("unable to read the file: %w", err)
-	}
-
-	result := fmt.Sprintf("%x", md5.Sum(content))
-	return result == md5sum, nil
-}
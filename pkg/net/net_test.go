@@ -0,0 +1,437 @@
+package net
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testPayload is the test file content, not aligned to the chunk size
+var testPayload = bytes.Repeat([]byte("opengapps-"), 1001)
+
+func newTestQueue(t *testing.T, ctx context.Context, retries int) (*DownloadQueue, func()) {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "net-test")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	dq := NewQueue(ctx, Options{MaxDownloads: 10, Retries: retries, Chunks: 4, Dir: dir})
+	dq.backoff = time.Millisecond
+	return dq, func() { _ = os.RemoveAll(dir) }
+}
+
+// serveRanges serves the payload with the range requests support
+func serveRanges(w http.ResponseWriter, r *http.Request) {
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(testPayload))
+}
+
+// requests counts the requests by their Range header
+type requests struct {
+	ranges map[string]int
+	mtx    sync.Mutex
+}
+
+func (rs *requests) add(r *http.Request) int {
+	rs.mtx.Lock()
+	defer rs.mtx.Unlock()
+	if rs.ranges == nil {
+		rs.ranges = make(map[string]int)
+	}
+	rs.ranges[r.Header.Get("Range")]++
+	return rs.ranges[r.Header.Get("Range")]
+}
+
+func (rs *requests) count(rng string) int {
+	rs.mtx.Lock()
+	defer rs.mtx.Unlock()
+	return rs.ranges[rng]
+}
+
+func testMD5(b []byte) string {
+	sum := md5.Sum(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// chunkFiles returns the chunk files left in the queue folder
+func chunkFiles(t *testing.T, dq *DownloadQueue) []string {
+	t.Helper()
+	files, err := filepath.Glob(filepath.Join(dq.dir, "*"+chunkSuffix))
+	if err != nil {
+		t.Fatalf("unable to list chunk files: %v", err)
+	}
+	return files
+}
+
+func TestAddMultiple(t *testing.T) {
+	var flaky requests
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		md5     string
+		size    int
+		ok      bool
+	}{
+		{
+			name:    "ranges",
+			handler: serveRanges,
+			md5:     testMD5(testPayload),
+			size:    len(testPayload),
+			ok:      true,
+		},
+		{
+			name: "no range support falls back to single thread",
+			handler: func(w http.ResponseWriter, _ *http.Request) {
+				_, _ = w.Write(testPayload)
+			},
+			md5:  testMD5(testPayload),
+			size: len(testPayload),
+			ok:   true,
+		},
+		{
+			name: "retried chunks",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				if flaky.add(r) <= 2 {
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+				serveRanges(w, r)
+			},
+			md5:  testMD5(testPayload),
+			size: len(testPayload),
+			ok:   true,
+		},
+		{
+			name:    "unknown size",
+			handler: serveRanges,
+			md5:     testMD5(testPayload),
+			size:    0,
+			ok:      true,
+		},
+		{
+			name:    "checksum mismatch",
+			handler: serveRanges,
+			md5:     testMD5([]byte("other")),
+			size:    len(testPayload),
+		},
+		{
+			name: "short file in single thread",
+			handler: func(w http.ResponseWriter, _ *http.Request) {
+				_, _ = w.Write(testPayload[:100])
+			},
+			size: len(testPayload),
+		},
+		{
+			name: "failed chunks",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				if strings.HasPrefix(r.Header.Get("Range"), "bytes=0-") {
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+				serveRanges(w, r)
+			},
+			size: len(testPayload),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(tt.handler)
+			defer srv.Close()
+			dq, cleanup := newTestQueue(t, context.Background(), 2)
+			defer cleanup()
+
+			path, _, err := dq.AddMultiple(context.Background(), srv.URL, tt.md5, tt.size, nil)
+			if !tt.ok {
+				if err == nil {
+					_ = os.Remove(path)
+					t.Fatal("AddMultiple() succeeded, want error")
+				}
+				if files := chunkFiles(t, dq); len(files) > 0 {
+					t.Errorf("chunk files %v are left after the failure", files)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("AddMultiple() returned error: %v", err)
+			}
+			defer os.Remove(path)
+
+			body, err := ioutil.ReadFile(path)
+			if err != nil {
+				t.Fatalf("unable to read result file: %v", err)
+			}
+			if !bytes.Equal(body, testPayload) {
+				t.Errorf("result file has %d bytes, want %d bytes of payload", len(body), len(testPayload))
+			}
+		})
+	}
+}
+
+func TestAddMultipleRetryBudget(t *testing.T) {
+	var rs requests
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.Header.Get("Range"), "bytes=0-") {
+			rs.add(r)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		serveRanges(w, r)
+	}))
+	defer srv.Close()
+	dq, cleanup := newTestQueue(t, context.Background(), 3)
+	defer cleanup()
+
+	// the failed chunk used to block the download forever, so it's never waited for too long
+	done := make(chan error, 1)
+	go func() {
+		_, _, err := dq.AddMultiple(context.Background(), srv.URL, "", len(testPayload), nil)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err == nil || !strings.Contains(err.Error(), "retry budget exceeded") {
+			t.Errorf("AddMultiple() error = %v, want retry budget exceeded", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("AddMultiple() is stuck on the failed chunk")
+	}
+
+	chunk := splitChunks("", int64(len(testPayload)), 4)[0]
+	if got := rs.count("bytes=0-" + itoa(chunk.end-1)); got != 4 {
+		t.Errorf("failed chunk is requested %d times, want 4", got)
+	}
+}
+
+func TestAddMultipleShortChunk(t *testing.T) {
+	chunk := splitChunks("", int64(len(testPayload)), 4)[0]
+	tests := []struct {
+		name    string
+		retries int
+		ok      bool
+	}{
+		// the short chunk is never taken as complete
+		{"rejected", 0, false},
+		// the retry resumes the chunk from the bytes received
+		{"resumed", 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if !strings.HasPrefix(r.Header.Get("Range"), "bytes=0-") {
+					serveRanges(w, r)
+					return
+				}
+				// the range is confirmed, but the body is cut short
+				w.Header().Set("Content-Range", "bytes 0-"+itoa(chunk.end-1)+"/"+itoa(int64(len(testPayload))))
+				w.WriteHeader(http.StatusPartialContent)
+				_, _ = w.Write(testPayload[:10])
+				w.(http.Flusher).Flush()
+			}))
+			defer srv.Close()
+			dq, cleanup := newTestQueue(t, context.Background(), tt.retries)
+			defer cleanup()
+
+			path, _, err := dq.AddMultiple(context.Background(), srv.URL, testMD5(testPayload), len(testPayload), nil)
+			if err == nil {
+				defer os.Remove(path)
+			}
+			if (err == nil) != tt.ok {
+				t.Errorf("AddMultiple() error = %v, want ok %t", err, tt.ok)
+			}
+		})
+	}
+}
+
+func TestAddMultipleResume(t *testing.T) {
+	var rs requests
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rs.add(r)
+		serveRanges(w, r)
+	}))
+	defer srv.Close()
+	dq, cleanup := newTestQueue(t, context.Background(), 0)
+	defer cleanup()
+
+	// the first chunk is left half-done and the second one complete by the previous run
+	size := int64(len(testPayload))
+	chunks := splitChunks(dq.basePath(srv.URL, size, 4), size, 4)
+	if err := os.MkdirAll(dq.dir, 0755); err != nil {
+		t.Fatalf("unable to create download folder: %v", err)
+	}
+	half := chunks[0].size() / 2
+	if err := ioutil.WriteFile(chunks[0].path, testPayload[:half], 0644); err != nil {
+		t.Fatalf("unable to write chunk file: %v", err)
+	}
+	if err := ioutil.WriteFile(chunks[1].path, testPayload[chunks[1].start:chunks[1].end], 0644); err != nil {
+		t.Fatalf("unable to write chunk file: %v", err)
+	}
+
+	path, sums, err := dq.AddMultiple(context.Background(), srv.URL, testMD5(testPayload), len(testPayload), nil)
+	if err != nil {
+		t.Fatalf("AddMultiple() returned error: %v", err)
+	}
+	defer os.Remove(path)
+
+	if sums.MD5 != testMD5(testPayload) {
+		t.Errorf("MD5 = %s, want %s", sums.MD5, testMD5(testPayload))
+	}
+	if got := rs.count("bytes=" + itoa(half) + "-" + itoa(chunks[0].end-1)); got != 1 {
+		t.Errorf("half-done chunk is resumed %d times, want 1 (requests: %v)", got, rs.ranges)
+	}
+	for rng := range rs.ranges {
+		if strings.HasPrefix(rng, "bytes=0-") || strings.HasPrefix(rng, "bytes="+itoa(chunks[1].start)+"-") {
+			t.Errorf("downloaded part is requested again: %s", rng)
+		}
+	}
+}
+
+func TestAddMultipleCancel(t *testing.T) {
+	tests := []struct {
+		name string
+		// shutdown cancels the app context instead of the request one
+		shutdown bool
+		kept     bool
+	}{
+		{"cancelled by user", false, false},
+		{"aborted by shutdown", true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			started := make(chan struct{}, 4)
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				// send a part of the chunk and hang until the client is gone
+				w.Header().Set("Content-Range", strings.Replace(r.Header.Get("Range"), "=", " ", 1)+"/*")
+				w.WriteHeader(http.StatusPartialContent)
+				_, _ = w.Write(testPayload[:10])
+				w.(http.Flusher).Flush()
+				started <- struct{}{}
+				<-r.Context().Done()
+			}))
+			defer srv.Close()
+
+			appCtx, appCancel := context.WithCancel(context.Background())
+			defer appCancel()
+			ctx, cancel := context.WithCancel(appCtx)
+			defer cancel()
+			dq, cleanup := newTestQueue(t, appCtx, 0)
+			defer cleanup()
+
+			go func() {
+				<-started
+				if tt.shutdown {
+					appCancel()
+				} else {
+					cancel()
+				}
+			}()
+			if _, _, err := dq.AddMultiple(ctx, srv.URL, "", len(testPayload), nil); err == nil {
+				t.Fatal("AddMultiple() succeeded, want error")
+			}
+
+			if files := chunkFiles(t, dq); (len(files) > 0) != tt.kept {
+				t.Errorf("chunk files left: %v, want kept %t", files, tt.kept)
+			}
+		})
+	}
+}
+
+func itoa(n int64) string {
+	return strconv.FormatInt(n, 10)
+}
+
+// testObserver records the queue events
+type testObserver struct {
+	nopObserver
+	mtx        sync.Mutex
+	tokens     int
+	bytes      int
+	modes      []string
+	mismatches int
+}
+
+func (o *testObserver) Acquired(time.Duration) { o.mtx.Lock(); o.tokens++; o.mtx.Unlock() }
+func (o *testObserver) Released()              { o.mtx.Lock(); o.tokens--; o.mtx.Unlock() }
+func (o *testObserver) Downloaded(n int)       { o.mtx.Lock(); o.bytes += n; o.mtx.Unlock() }
+func (o *testObserver) ChecksumMismatch()      { o.mtx.Lock(); o.mismatches++; o.mtx.Unlock() }
+func (o *testObserver) Finished(mode string, _ time.Duration, _ error) {
+	o.mtx.Lock()
+	o.modes = append(o.modes, mode)
+	o.mtx.Unlock()
+}
+
+func TestObserver(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(serveRanges))
+	defer srv.Close()
+	dq, cleanup := newTestQueue(t, context.Background(), 0)
+	defer cleanup()
+	obs := &testObserver{}
+	dq.obs = obs
+
+	path, _, err := dq.AddMultiple(context.Background(), srv.URL, testMD5(testPayload), len(testPayload), nil)
+	if err != nil {
+		t.Fatalf("AddMultiple() returned error: %v", err)
+	}
+	_ = os.Remove(path)
+	if _, _, err = dq.AddMultiple(context.Background(), srv.URL, testMD5([]byte("other")), 0, nil); err == nil {
+		t.Fatal("AddMultiple() succeeded, want checksum mismatch")
+	}
+
+	if obs.tokens != 0 {
+		t.Errorf("%d queue tokens are not released", obs.tokens)
+	}
+	if obs.bytes != 2*len(testPayload) {
+		t.Errorf("downloaded bytes = %d, want %d", obs.bytes, 2*len(testPayload))
+	}
+	if len(obs.modes) != 2 || obs.modes[0] != ModeMulti || obs.modes[1] != ModeSingle {
+		t.Errorf("finished downloads = %v, want [%s %s]", obs.modes, ModeMulti, ModeSingle)
+	}
+	if obs.mismatches != 1 {
+		t.Errorf("checksum mismatches = %d, want 1", obs.mismatches)
+	}
+}
+
+func TestChecksums(t *testing.T) {
+	// the known checksums of testPayload
+	want := Checksums{
+		MD5:    "c7147aa37f9170d0dda5a9068f7e7922",
+		SHA1:   "10857e7998bd36c8f50a421edcd4fce5c4f286f1",
+		SHA256: "d17b83ab2fc99fec28ff0bf61943594290a0ae7c9df4929047b00096939be6c9",
+	}
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		size    int
+	}{
+		{"multi", serveRanges, len(testPayload)},
+		{"single", serveRanges, 0},
+		{"single fallback", func(w http.ResponseWriter, _ *http.Request) { _, _ = w.Write(testPayload) }, len(testPayload)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(tt.handler)
+			defer srv.Close()
+			dq, cleanup := newTestQueue(t, context.Background(), 0)
+			defer cleanup()
+
+			path, sums, err := dq.AddMultiple(context.Background(), srv.URL, want.MD5, tt.size, nil)
+			if err != nil {
+				t.Fatalf("AddMultiple() returned error: %v", err)
+			}
+			defer os.Remove(path)
+			if sums != want {
+				t.Errorf("AddMultiple() checksums = %+v, want %+v", sums, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package net
+
+import "time"
+
+// Download modes reported to the Observer
+const (
+	ModeSingle = "single"
+	ModeMulti  = "multi"
+)
+
+// Observer receives the events of the DownloadQueue, e.g. to record the metrics.
+// The methods are called concurrently and must not block.
+type Observer interface {
+	// QueueCapacity reports the maximum number of the queue tokens
+	QueueCapacity(n int)
+	// Acquired reports the queue token taken after the wait
+	Acquired(wait time.Duration)
+	// Released reports the queue token returned
+	Released()
+	// Downloaded reports the number of the bytes received
+	Downloaded(n int)
+	// Finished reports the download result by mode (ModeSingle or ModeMulti)
+	Finished(mode string, d time.Duration, err error)
+	// ChecksumMismatch reports the downloaded file with the wrong MD5 checksum
+	ChecksumMismatch()
+}
+
+// nopObserver is used if no Observer is set
+type nopObserver struct{}
+
+func (nopObserver) QueueCapacity(int)                     {}
+func (nopObserver) Acquired(time.Duration)                {}
+func (nopObserver) Released()                             {}
+func (nopObserver) Downloaded(int)                        {}
+func (nopObserver) Finished(string, time.Duration, error) {}
+func (nopObserver) ChecksumMismatch()                     {}
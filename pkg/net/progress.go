@@ -0,0 +1,142 @@
+package net
+
+import (
+	"io"
+	"sync"
+)
+
+// Stage is an enum for the file transfer stages
+type Stage uint
+
+// Stage consts
+const (
+	StageDownload Stage = iota
+	StageVerify
+	StageMove
+	StageUpload
+)
+
+// ChunkState is an enum for the states of the downloaded chunk
+type ChunkState uint
+
+// ChunkState consts
+const (
+	ChunkPending ChunkState = iota
+	ChunkActive
+	ChunkDone
+	ChunkFailed
+)
+
+// Progress describes the current state of the file transfer
+type Progress struct {
+	Stage  Stage
+	Done   int64
+	Total  int64
+	Chunks []ChunkState
+}
+
+// ProgressFunc is called every time the transfer progress changes.
+// It's called synchronously by the readers (without holding any locks), so it should not block for long.
+// The concurrent calls may deliver the snapshots slightly out of order.
+type ProgressFunc func(Progress)
+
+// tracker safely accumulates the progress and reports it to the ProgressFunc
+type tracker struct {
+	progress Progress
+	fn       ProgressFunc
+	mtx      sync.Mutex
+}
+
+func newTracker(stage Stage, total int64, chunks int, fn ProgressFunc) *tracker {
+	return &tracker{
+		progress: Progress{Stage: stage, Total: total, Chunks: make([]ChunkState, chunks)},
+		fn:       fn,
+	}
+}
+
+func (t *tracker) add(n int) {
+	if t == nil || n <= 0 {
+		return
+	}
+	t.mtx.Lock()
+	t.progress.Done += int64(n)
+	p := t.snapshot()
+	t.mtx.Unlock()
+	t.report(p)
+}
+
+// resetDone resets the transferred bytes before the transfer is restarted
+func (t *tracker) resetDone() {
+	if t == nil {
+		return
+	}
+	t.mtx.Lock()
+	t.progress.Done = 0
+	p := t.snapshot()
+	t.mtx.Unlock()
+	t.report(p)
+}
+
+func (t *tracker) setChunk(i int, state ChunkState) {
+	if t == nil || i >= len(t.progress.Chunks) {
+		return
+	}
+	t.mtx.Lock()
+	t.progress.Chunks[i] = state
+	p := t.snapshot()
+	t.mtx.Unlock()
+	t.report(p)
+}
+
+func (t *tracker) setStage(stage Stage) {
+	if t == nil {
+		return
+	}
+	t.mtx.Lock()
+	t.progress.Stage = stage
+	p := t.snapshot()
+	t.mtx.Unlock()
+	t.report(p)
+}
+
+// snapshot returns a copy of the progress, it must be called under the lock
+func (t *tracker) snapshot() Progress {
+	p := t.progress
+	p.Chunks = make([]ChunkState, len(t.progress.Chunks))
+	copy(p.Chunks, t.progress.Chunks)
+	return p
+}
+
+// report passes the progress snapshot to the ProgressFunc, it must be called without the lock
+// so that the other readers are not blocked by the ProgressFunc
+func (t *tracker) report(p Progress) {
+	if t.fn != nil {
+		t.fn(p)
+	}
+}
+
+func trackReader(r io.Reader, t *tracker) io.Reader {
+	if t == nil {
+		return r
+	}
+	return &progressReader{r: r, t: t}
+}
+
+type progressReader struct {
+	r io.Reader
+	t *tracker
+}
+
+// NewProgressReader wraps the reader to report the read progress to the ProgressFunc
+func NewProgressReader(r io.Reader, stage Stage, total int64, fn ProgressFunc) io.Reader {
+	if fn == nil {
+		return r
+	}
+	return trackReader(r, newTracker(stage, total, 0, fn))
+}
+
+func (pr *progressReader) Read(p []byte) (int, error) {
+	n, err := pr.r.Read(p)
+	pr.t.add(n)
+	return n, err
+}
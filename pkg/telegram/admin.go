@@ -0,0 +1,190 @@
+package telegram
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/nezorflame/opengapps-mirror-bot/internal/pkg/i18n"
+	"github.com/nezorflame/opengapps-mirror-bot/internal/pkg/jobs"
+	"github.com/nezorflame/opengapps-mirror-bot/internal/pkg/storage"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	log "github.com/sirupsen/logrus"
+)
+
+const statsTopCount = 5
+
+// admin runs the handler if the message is sent by one of the admins ('telegram.admins'), refusing it otherwise
+func (b *Bot) admin(msg *tgbotapi.Message, handler func(*tgbotapi.Message)) {
+	if msg.From == nil || !b.isAdmin(msg.From.ID) {
+		log.WithField("chat_id", msg.Chat.ID).WithField("msg_id", msg.MessageID).Warn("Refused the admin command")
+		b.reply(msg.Chat.ID, msg.MessageID, b.lang(msg.From).T("admin.refused", nil))
+		return
+	}
+	handler(msg)
+}
+
+func (b *Bot) isAdmin(userID int) bool {
+	for _, id := range b.cfg.GetIntSlice("telegram.admins") {
+		if id == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// refresh checks for the latest release right away
+func (b *Bot) refresh(msg *tgbotapi.Message) {
+	l := b.lang(msg.From)
+	logger := log.WithField("chat_id", msg.Chat.ID).WithField("msg_id", msg.MessageID)
+	ctx, done := b.tasks.start(b.ctx, msg.Chat.ID, b.cfg.GetDuration("gapps.mirror_timeout"))
+	defer done()
+
+	s, added, err := b.gs.AddLatestStorage(ctx, b.gh, b.dq, b.cfg)
+	if err != nil {
+		logger.Errorf("Unable to add the latest storage: %v", err)
+		b.reply(msg.Chat.ID, msg.MessageID, b.errText(ctx, l, "errors.unknown"))
+		return
+	}
+
+	if !added {
+		b.reply(msg.Chat.ID, msg.MessageID, l.T("refresh.ok", i18n.Args{"date": s.Date}))
+		return
+	}
+	logger.Infof("Got the new release %s", s.Date)
+	b.reply(msg.Chat.ID, msg.MessageID, l.T("refresh.new", i18n.Args{"date": s.Date}))
+	b.Release(s)
+}
+
+// storages lists the known releases with their package counts
+func (b *Bot) storages(msg *tgbotapi.Message) {
+	l := b.lang(msg.From)
+	current, _ := b.gs.Get(storage.CurrentStorageKey)
+
+	dates := b.gs.Dates()
+	lines := make([]string, 0, len(dates))
+	for _, date := range dates {
+		s, ok := b.gs.Get(date)
+		if !ok {
+			continue
+		}
+		line := l.N("storages.entry", s.Len(), i18n.Args{"date": date})
+		if s == current {
+			line += " " + l.T("storages.current", nil)
+		}
+		lines = append(lines, line)
+	}
+	b.reply(msg.Chat.ID, msg.MessageID, l.T("storages.list", i18n.Args{"storages": strings.Join(lines, "\n")}))
+}
+
+// purge removes the release storage from memory, the cache and the local mirrors.
+// The current release is fetched again right away.
+func (b *Bot) purge(msg *tgbotapi.Message) {
+	l := b.lang(msg.From)
+	logger := log.WithField("chat_id", msg.Chat.ID).WithField("msg_id", msg.MessageID)
+	parts := strings.Fields(msg.Text)
+	if len(parts) != 2 {
+		b.reply(msg.Chat.ID, msg.MessageID, l.T("purge.usage", nil))
+		return
+	}
+
+	date := parts[1]
+	current, err := b.gs.Purge(date, b.ups)
+	if err != nil {
+		if errors.Is(err, storage.ErrStorageNotFound) {
+			b.reply(msg.Chat.ID, msg.MessageID, l.T("admin.not_found", i18n.Args{"date": date}))
+			return
+		}
+		logger.Errorf("Unable to purge the storage: %v", err)
+		b.reply(msg.Chat.ID, msg.MessageID, l.T("errors.unknown", nil))
+		return
+	}
+	logger.Infof("Purged the storage %s", date)
+
+	if current {
+		ctx, done := b.tasks.start(b.ctx, msg.Chat.ID, b.cfg.GetDuration("gapps.mirror_timeout"))
+		defer done()
+		if _, _, err = b.gs.AddLatestStorage(ctx, b.gh, b.dq, b.cfg); err != nil {
+			logger.Errorf("Unable to add the latest storage: %v", err)
+		}
+	}
+	b.reply(msg.Chat.ID, msg.MessageID, l.T("purge.ok", i18n.Args{"date": date}))
+}
+
+// remirror discards the package mirrors and creates them anew
+func (b *Bot) remirror(msg *tgbotapi.Message) {
+	l := b.lang(msg.From)
+	parts := strings.Fields(msg.Text)
+	if len(parts) < 2 {
+		b.reply(msg.Chat.ID, msg.MessageID, l.T("remirror.usage", nil))
+		return
+	}
+
+	platform, android, variant, date, err := parseCmd(parts[1:], b.cfg.GetString("gapps.time_format"))
+	if err != nil {
+		b.reply(msg.Chat.ID, msg.MessageID, b.parseErrText(l, err))
+		return
+	}
+
+	s, ok := b.gs.Get(date)
+	if !ok {
+		b.reply(msg.Chat.ID, msg.MessageID, l.T("admin.not_found", i18n.Args{"date": date}))
+		return
+	}
+	pkg, ok := s.Get(platform, android, variant)
+	if !ok {
+		b.reply(msg.Chat.ID, msg.MessageID, l.T("mirror.not_found", nil))
+		return
+	}
+	if !pkg.ClearMirrors() {
+		b.reply(msg.Chat.ID, msg.MessageID, l.T("remirror.busy", nil))
+		return
+	}
+	log.WithField("chat_id", msg.Chat.ID).WithField("msg_id", msg.MessageID).Infof("Discarded the mirrors of the package %s", pkg.Name)
+
+	ctx, done := b.tasks.start(b.ctx, msg.Chat.ID, b.cfg.GetDuration("gapps.mirror_timeout"))
+	defer done()
+	b.runJob(ctx, s, pkg, jobs.Request{ChatID: msg.Chat.ID, MessageID: msg.MessageID, StatusID: b.reply(msg.Chat.ID, msg.MessageID, b.packageText(l, pkg)), Locale: l.Locale()})
+}
+
+// usage sends the usage summary of the bot
+func (b *Bot) usage(msg *tgbotapi.Message) {
+	l := b.lang(msg.From)
+	logger := log.WithField("chat_id", msg.Chat.ID).WithField("msg_id", msg.MessageID)
+	storages, packages := b.gs.Size()
+
+	entries, err := b.stats.List()
+	if err != nil {
+		logger.Errorf("Unable to get request stats: %v", err)
+	}
+	requests := 0
+	for _, e := range entries {
+		requests += e.Count
+	}
+
+	subs, err := b.subs.List()
+	if err != nil {
+		logger.Errorf("Unable to get subscriptions: %v", err)
+	}
+
+	top := l.T("stats.empty", nil)
+	if len(entries) > statsTopCount {
+		entries = entries[:statsTopCount]
+	}
+	if len(entries) > 0 {
+		lines := make([]string, len(entries))
+		for i, e := range entries {
+			lines[i] = l.N("stats.entry", e.Count, i18n.Args{"package": e.PackageKey})
+		}
+		top = strings.Join(lines, "\n")
+	}
+
+	b.reply(msg.Chat.ID, msg.MessageID, l.T("stats.summary", i18n.Args{
+		"storages":      storages,
+		"packages":      packages,
+		"requests":      requests,
+		"subscriptions": len(subs),
+		"running":       b.tasks.count(),
+		"top":           top,
+	}))
+}
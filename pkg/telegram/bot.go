@@ -4,12 +4,21 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/http"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/nezorflame/opengapps-mirror-bot/internal/pkg/bans"
+	"github.com/nezorflame/opengapps-mirror-bot/internal/pkg/health"
+	"github.com/nezorflame/opengapps-mirror-bot/internal/pkg/i18n"
+	"github.com/nezorflame/opengapps-mirror-bot/internal/pkg/jobs"
+	"github.com/nezorflame/opengapps-mirror-bot/internal/pkg/stats"
 	"github.com/nezorflame/opengapps-mirror-bot/internal/pkg/storage"
+	"github.com/nezorflame/opengapps-mirror-bot/internal/pkg/subscription"
 	"github.com/nezorflame/opengapps-mirror-bot/pkg/gapps"
 	"github.com/nezorflame/opengapps-mirror-bot/pkg/net"
+	"github.com/nezorflame/opengapps-mirror-bot/pkg/upload"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/google/go-github/v37/github"
@@ -18,32 +27,67 @@ import (
 )
 
 const (
-	platformErrText = "does not belong to Platform values"
-	androidErrText  = "does not belong to Android values"
-	variantErrText  = "does not belong to Variant values"
-	dateErrText     = "unable to parse time"
-	mirrorFormat    = "[%s](%s)"
+	mirrorFormat   = "[%s](%s)"
+	pollRetryDelay = 3 * time.Second
+	// maxMessageLength is the Telegram limit for the message text
+	maxMessageLength = 4096
 )
 
 // Bot describes Telegram bot
 type Bot struct {
-	ctx context.Context
-	api *tgbotapi.BotAPI
-	cfg *viper.Viper
-	dq  *net.DownloadQueue
-	gs  *storage.GlobalStorage
-	gh  *github.Client
+	ctx      context.Context
+	api      *tgbotapi.BotAPI
+	cfg      *viper.Viper
+	dq       *net.DownloadQueue
+	ups      []upload.Uploader
+	gs       *storage.GlobalStorage
+	gh       *github.Client
+	subs     *subscription.Store
+	stats    *stats.Store
+	jobs     *jobs.Store
+	bans     *bans.Store
+	releases *storage.Releases
+	tr       *i18n.Translator
+	locales  *i18n.Store
+	tasks    *tasks
+	limits   *limits
+	commands map[string]command
+	obs      Observer
+
+	polled  health.Heartbeat
+	started health.Heartbeat
+	updates chan tgbotapi.Update
+	hook    *http.Server
+	stop    chan struct{}
+	once    sync.Once
+}
+
+// Deps describes the services used by the Bot
+type Deps struct {
+	Queue      *net.DownloadQueue
+	Uploaders  []upload.Uploader
+	Storage    *storage.GlobalStorage
+	Github     *github.Client
+	Subs       *subscription.Store
+	Stats      *stats.Store
+	Jobs       *jobs.Store
+	Bans       *bans.Store
+	Translator *i18n.Translator
+	Locales    *i18n.Store
+	Releases   *storage.Releases
+	// Observer receives the bot events (optional)
+	Observer Observer
 }
 
 // NewBot creates new instance of Bot
-func NewBot(ctx context.Context, cfg *viper.Viper, dq *net.DownloadQueue, gs *storage.GlobalStorage, gh *github.Client) (*Bot, error) {
+func NewBot(ctx context.Context, cfg *viper.Viper, deps Deps) (*Bot, error) {
 	if cfg == nil {
 		return nil, errors.New("empty config")
 	}
 
 	api, err := tgbotapi.NewBotAPI(cfg.GetString("telegram.token"))
 	if err != nil {
-		return nil, fmt.Errorf(", err, unable to connect to Telegram")
+		return nil, fmt.Errorf("unable to connect to Telegram: %w", err)
 	}
 	if cfg.GetBool("telegram.debug") {
 		log.Debug("Enabling debug mode for bot")
@@ -51,135 +95,352 @@ func NewBot(ctx context.Context, cfg *viper.Viper, dq *net.DownloadQueue, gs *st
 	}
 
 	log.Debugf("Authorized on account %s", api.Self.UserName)
-	return &Bot{api: api, cfg: cfg, ctx: ctx, dq: dq, gs: gs, gh: gh}, nil
+	b := &Bot{
+		api:      api,
+		cfg:      cfg,
+		ctx:      ctx,
+		dq:       deps.Queue,
+		ups:      deps.Uploaders,
+		gs:       deps.Storage,
+		gh:       deps.Github,
+		subs:     deps.Subs,
+		stats:    deps.Stats,
+		jobs:     deps.Jobs,
+		bans:     deps.Bans,
+		releases: deps.Releases,
+		tr:       deps.Translator,
+		locales:  deps.Locales,
+		obs:      deps.Observer,
+		tasks:    newTasks(),
+		limits:   newLimits(cfg),
+		updates:  make(chan tgbotapi.Update, api.Buffer),
+		stop:     make(chan struct{}),
+	}
+	if b.obs == nil {
+		b.obs = nopObserver{}
+	}
+	b.commands = b.newCommands()
+	if cfg.GetString("telegram.mode") == ModeWebhook {
+		if b.hook, err = b.newWebhookServer(); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
 }
 
-// Start starts to listen the bot updates channel
-func (b *Bot) Start() {
+// Start starts to listen the bot updates, either with long polling or with webhook ('telegram.mode')
+func (b *Bot) Start() error {
+	b.started.Beat()
+	if b.hook != nil {
+		updates, err := b.webhook()
+		if err != nil {
+			return err
+		}
+		b.listen(updates)
+		return nil
+	}
+
 	update := tgbotapi.NewUpdate(0)
 	update.Timeout = b.cfg.GetInt("telegram.timeout")
-	b.listen(b.api.GetUpdatesChan(update))
+	b.listen(b.poll(update))
+	return nil
 }
 
-// Stop stops the bot
+// Stop stops the bot, deleting the webhook in webhook mode
 func (b *Bot) Stop() {
-	b.api.StopReceivingUpdates()
+	b.once.Do(func() {
+		close(b.stop)
+		if b.hook != nil {
+			b.stopWebhook()
+		}
+	})
+}
+
+// PollAge returns the time passed since the last successful long polling request
+// or webhook check, or false if there were none yet
+func (b *Bot) PollAge() (time.Duration, bool) {
+	return b.polled.Age()
+}
+
+// StartAge returns the time passed since the bot was started, or false if it wasn't started yet
+func (b *Bot) StartAge() (time.Duration, bool) {
+	return b.started.Age()
+}
+
+// poll gets the updates with long polling, recording every successful request
+func (b *Bot) poll(config tgbotapi.UpdateConfig) tgbotapi.UpdatesChannel {
+	ch := b.updates
+	go func() {
+		for {
+			select {
+			case <-b.stop:
+				return
+			default:
+			}
+
+			updates, err := b.api.GetUpdates(config)
+			if err != nil {
+				log.Errorf("Unable to get updates, retrying in %s: %v", pollRetryDelay, err)
+				select {
+				case <-time.After(pollRetryDelay):
+				case <-b.stop:
+					return
+				}
+				continue
+			}
+			b.polled.Beat()
+
+			for _, u := range updates {
+				if u.UpdateID >= config.Offset {
+					config.Offset = u.UpdateID + 1
+					ch <- u
+				}
+			}
+		}
+	}()
+	return ch
 }
 
 func (b *Bot) listen(updates tgbotapi.UpdatesChannel) {
 	for u := range updates {
-		if u.Message == nil { // ignore any non-Message Updates
+		if u.InlineQuery != nil {
+			if _, ok := b.allowed(u.InlineQuery.From, 0); !ok {
+				continue
+			}
+			log.WithField("user_id", u.InlineQuery.From.ID).Debug("Got inline query")
+			b.obs.Command("inline")
+			go b.inline(u.InlineQuery)
+			continue
+		}
+
+		if u.ChosenInlineResult != nil {
+			log.WithField("user_id", u.ChosenInlineResult.From.ID).Debug("Got chosen inline result")
+			b.obs.Command("chosen_inline")
+			go b.chosenInline(u.ChosenInlineResult)
+			continue
+		}
+
+		if u.CallbackQuery != nil {
+			var chatID int64
+			if u.CallbackQuery.Message != nil {
+				chatID = u.CallbackQuery.Message.Chat.ID
+			}
+			if text, ok := b.allowed(u.CallbackQuery.From, chatID); !ok {
+				go b.answerCallback(u.CallbackQuery.ID, text)
+				continue
+			}
+			log.WithField("user_id", u.CallbackQuery.From.ID).Debug("Got callback query")
+			b.obs.Command("callback")
+			go b.callback(u.CallbackQuery)
 			continue
 		}
 
-		switch {
-		case strings.HasPrefix(u.Message.Text, b.cfg.GetString("commands.start")):
-			go b.hello(u.Message)
-		case strings.HasPrefix(u.Message.Text, b.cfg.GetString("commands.help")):
-			log.WithField("user_id", u.Message.From.ID).Debug("Got help request")
-			go b.help(u.Message)
-		case strings.HasPrefix(u.Message.Text, b.cfg.GetString("commands.mirror")):
-			log.WithField("user_id", u.Message.From.ID).Debug("Got mirror request")
-			go b.mirror(u.Message)
+		if u.Message == nil { // ignore any other non-Message Updates
+			continue
+		}
+
+		if u.Message.From != nil && u.Message.IsCommand() {
+			if text, ok := b.allowed(u.Message.From, u.Message.Chat.ID); !ok {
+				if text != "" {
+					go b.reply(u.Message.Chat.ID, u.Message.MessageID, text)
+				}
+				continue
+			}
+		}
+
+		cmd, ok := b.commands[commandName(u.Message.Text)]
+		if !ok {
+			continue
+		}
+		log.WithField("user_id", userID(u.Message.From)).Debugf("Got %s request", cmd.name)
+		b.obs.Command(cmd.name)
+		if cmd.admin {
+			go b.admin(u.Message, cmd.handler)
+		} else {
+			go cmd.handler(u.Message)
 		}
 	}
 }
 
+// command describes the handler of the bot command
+type command struct {
+	name    string
+	handler func(*tgbotapi.Message)
+	admin   bool
+}
+
+// newCommands returns the command handlers by their text set in the 'commands' config section
+func (b *Bot) newCommands() map[string]command {
+	cmds := []command{
+		{"start", b.hello, false},
+		{"help", b.help, false},
+		{"mirror", b.mirror, false},
+		{"subscribe", b.subscribe, false},
+		{"unsubscribe", b.unsubscribe, false},
+		{"cancel", b.cancel, false},
+		{"language", b.language, false},
+		{"dates", b.dates, false},
+		{"list", b.list, false},
+		{"diff", b.diff, false},
+		{"refresh", b.refresh, true},
+		{"storages", b.storages, true},
+		{"purge", b.purge, true},
+		{"remirror", b.remirror, true},
+		{"stats", b.usage, true},
+		{"ban", b.ban, true},
+		{"unban", b.unban, true},
+	}
+
+	commands := make(map[string]command, len(cmds))
+	for _, c := range cmds {
+		commands[b.cfg.GetString("commands."+c.name)] = c
+	}
+	return commands
+}
+
+// commandName returns the command of the message text without the args and the bot username (e.g. "/mirror@bot")
+func commandName(text string) string {
+	parts := strings.Fields(text)
+	if len(parts) == 0 {
+		return ""
+	}
+	if i := strings.Index(parts[0], "@"); i > 0 {
+		return parts[0][:i]
+	}
+	return parts[0]
+}
+
 func (b *Bot) hello(msg *tgbotapi.Message) {
-	b.reply(msg.Chat.ID, msg.MessageID, b.cfg.GetString("messages.hello"))
+	b.reply(msg.Chat.ID, msg.MessageID, b.lang(msg.From).T("hello", nil))
 }
 
 func (b *Bot) help(msg *tgbotapi.Message) {
-	b.reply(msg.Chat.ID, msg.MessageID, b.cfg.GetString("messages.help"))
+	b.reply(msg.Chat.ID, msg.MessageID, b.lang(msg.From).T("help", nil))
+}
+
+func (b *Bot) cancel(msg *tgbotapi.Message) {
+	l := b.lang(msg.From)
+	if count := b.tasks.cancel(msg.Chat.ID); count > 0 {
+		b.reply(msg.Chat.ID, msg.MessageID, l.N("cancel.ok", count, nil))
+		return
+	}
+	b.reply(msg.Chat.ID, msg.MessageID, l.T("cancel.none", nil))
 }
 
 func (b *Bot) mirror(msg *tgbotapi.Message) {
+	l := b.lang(msg.From)
+	if msg.From == nil {
+		b.reply(msg.Chat.ID, msg.MessageID, l.T("errors.mirror", nil))
+		return
+	}
+
 	// parse the message
-	logger := log.WithField("chat_id", msg.Chat.ID).WithField("msg_id", msg.MessageID)
-	cmd := strings.Replace(msg.Text, ".", "", -1)
-	parts := strings.Split(cmd, " ")
+	parts := strings.Fields(msg.Text)
 	if len(parts) < 2 {
-		b.reply(msg.Chat.ID, msg.MessageID, b.cfg.GetString("messages.errors.mirror"))
+		b.wizard(l, msg)
 		return
 	}
 
 	platform, android, variant, date, err := parseCmd(parts[1:], b.cfg.GetString("gapps.time_format"))
 	if err != nil {
-		errMsg := err.Error()
-		switch {
-		case strings.Contains(errMsg, platformErrText):
-			errMsg = b.cfg.GetString("messages.errors.platform")
-		case strings.Contains(errMsg, androidErrText):
-			errMsg = b.cfg.GetString("messages.errors.android")
-		case strings.Contains(errMsg, variantErrText):
-			errMsg = b.cfg.GetString("messages.errors.variant")
-		case strings.Contains(errMsg, dateErrText):
-			errMsg = b.cfg.GetString("messages.errors.date")
-		default:
-			errMsg = b.cfg.GetString("messages.errors.mirror")
-		}
-
-		b.reply(msg.Chat.ID, msg.MessageID, errMsg)
+		b.reply(msg.Chat.ID, msg.MessageID, b.parseErrText(l, err))
 		return
 	}
 
-	// look up the package storage
-	s, ok := b.gs.Get(date)
-	if !ok {
-		b.reply(msg.Chat.ID, msg.MessageID, b.cfg.GetString("messages.mirror.in_progress"))
+	b.sendMirror(l, msg.From.ID, msg.Chat.ID, msg.MessageID, platform, android, variant, date)
+}
 
-		var err error
-		if s, err = storage.GetPackageStorage(b.ctx, b.gh, b.dq, b.cfg, date); err != nil {
-			b.reply(msg.Chat.ID, msg.MessageID, b.cfg.GetString("messages.errors.unknown"))
-			logger.Fatal("No current storage available")
-		}
+// userID returns the ID of the user, or 0 for the messages without the sender (e.g. in channels)
+func userID(u *tgbotapi.User) int {
+	if u == nil {
+		return 0
+	}
+	return u.ID
+}
 
-		b.gs.Add(s.Date, s)
+func (b *Bot) sendMirror(l *i18n.Localizer, userID int, chatID int64, msgID int, platform gapps.Platform, android gapps.Android, variant gapps.Variant, date string) {
+	logger := log.WithField("chat_id", chatID).WithField("msg_id", msgID)
+	ctx, done := b.tasks.start(b.ctx, chatID, b.cfg.GetDuration("gapps.mirror_timeout"))
+	defer done()
+
+	// look up the package storage
+	s, ok := b.fetchStorage(ctx, l, userID, chatID, msgID, date)
+	if !ok {
+		return
 	}
 
 	// look up the package
 	pkg, ok := s.Get(platform, android, variant)
 	if !ok {
-		b.reply(msg.Chat.ID, msg.MessageID, b.cfg.GetString("messages.mirror.not_found"))
+		b.reply(chatID, msgID, b.missingText(l, s, gapps.Combo{Platform: platform, Android: android, Variant: variant}))
 		return
 	}
 
+	if err := b.stats.Inc(storage.PackageKey{Platform: platform, Android: android, Variant: variant}); err != nil {
+		logger.Errorf("Unable to record request stats: %v", err)
+	}
+
 	// check if we already have mirrors
-	text := ""
-	if pkg.LocalURL == "" && pkg.RemoteURL == "" {
-		text = fmt.Sprintf(b.cfg.GetString("messages.mirror.found"), pkg.Name, pkg.OriginURL, pkg.MD5, b.cfg.GetString("messages.mirror.missing"))
-		b.reply(msg.Chat.ID, 0, text)
-		logger.Debugf("Creating a mirror for the package %s", pkg.Name)
-		if err := pkg.CreateMirror(b.dq, b.cfg); err != nil {
-			logger.Errorf("Unable to create mirror: %v", err)
-			b.reply(msg.Chat.ID, msg.MessageID, b.cfg.GetString("messages.mirror.fail"))
+	if !pkg.HasMirrors() {
+		if text, ok := b.downloadAllowed(l, userID); !ok {
+			b.reply(chatID, msgID, text)
 			return
 		}
-		if err := s.Save(); err != nil {
-			logger.Errorf("Unable to save storage: %v", err)
-		}
-		text = b.cfg.GetString("messages.mirror.ok")
-	} else {
-		text = fmt.Sprintf(b.cfg.GetString("messages.mirror.found"), pkg.Name, pkg.OriginURL, pkg.MD5, b.cfg.GetString("messages.mirror.ok"))
+		text := b.packageText(l, pkg)
+		b.runJob(ctx, s, pkg, jobs.Request{ChatID: chatID, MessageID: msgID, StatusID: b.reply(chatID, msgID, text), Locale: l.Locale()})
+		return
 	}
 
 	logger.Debugf("Got the mirror for the package %s", pkg.Name)
-	mirrorResult := ""
-	if pkg.LocalURL != "" {
-		mirrorResult = fmt.Sprintf(mirrorFormat, b.cfg.GetString("gapps.local_host"), pkg.LocalURL)
+	b.reply(chatID, msgID, b.packageText(l, pkg))
+	logger.Infof("Sent mirror for pkg %s", pkg.Name)
+}
+
+// fetchStorage returns the Storage for the date, getting it from Github if it's not known yet.
+// It replies to the user and returns false if the Storage is not available.
+func (b *Bot) fetchStorage(ctx context.Context, l *i18n.Localizer, userID int, chatID int64, msgID int, date string) (*storage.Storage, bool) {
+	if s, ok := b.gs.Get(date); ok {
+		return s, true
 	}
-	if pkg.RemoteURL != "" {
-		if mirrorResult != "" {
-			mirrorResult += " | "
-		}
-		mirrorResult += fmt.Sprintf(mirrorFormat, b.cfg.GetString("gapps.remote_host"), pkg.RemoteURL)
+
+	logger := log.WithField("chat_id", chatID).WithField("msg_id", msgID).WithField("release_date", date)
+	if exists, err := b.releases.Exists(ctx, date); err != nil {
+		logger.Warnf("Unable to check the release date: %v", err)
+	} else if !exists {
+		b.reply(chatID, msgID, l.T("dates.unknown", i18n.Args{"date": date}))
+		return nil, false
 	}
 
-	b.reply(msg.Chat.ID, msg.MessageID, fmt.Sprintf(text, mirrorResult))
-	logger.Infof("Sent mirror for pkg %s", pkg.Name)
+	if text, ok := b.downloadAllowed(l, userID); !ok {
+		b.reply(chatID, msgID, text)
+		return nil, false
+	}
+	b.reply(chatID, msgID, l.T("mirror.in_progress", nil))
+
+	s, err := storage.GetPackageStorage(ctx, b.gh, b.dq, b.cfg, date)
+	switch {
+	case errors.Is(err, storage.ErrStorageNotFound):
+		b.reply(chatID, msgID, l.T("dates.unknown", i18n.Args{"date": date}))
+		return nil, false
+	case err != nil:
+		logger.Errorf("Unable to get package storage: %v", err)
+		b.reply(chatID, msgID, b.errText(ctx, l, "errors.unknown"))
+		return nil, false
+	}
+	return b.gs.AddIfMissing(s), true
+}
+
+func (b *Bot) mirrorLinks(pkg *storage.Package) string {
+	mirrors := pkg.HealthyMirrors()
+	links := make([]string, len(mirrors))
+	for i, m := range mirrors {
+		links[i] = fmt.Sprintf(mirrorFormat, m.Host, m.URL)
+	}
+	return strings.Join(links, " | ")
 }
 
-func (b *Bot) reply(chatID int64, msgID int, text string) {
+// reply sends the message and returns its ID (or 0 if it wasn't sent)
+func (b *Bot) reply(chatID int64, msgID int, text string) int {
 	log.WithField("chat_id", chatID).WithField("msg_id", msgID).Debug("Sending reply")
 	msg := tgbotapi.NewMessage(chatID, fmt.Sprint(text))
 	if msgID != 0 {
@@ -187,28 +448,76 @@ func (b *Bot) reply(chatID int64, msgID int, text string) {
 	}
 	msg.ParseMode = tgbotapi.ModeMarkdown
 
-	if _, err := b.api.Send(msg); err != nil {
+	sent, err := b.api.Send(msg)
+	if err != nil {
 		log.Errorf("Unable to send the message: %v", err)
-		return
+		return 0
 	}
+	return sent.MessageID
 }
 
-func parseCmd(parts []string, timeFormat string) (platform gapps.Platform, android gapps.Android, variant gapps.Variant, date string, err error) {
-	date = "current"
-	switch len(parts) {
-	case 4:
-		if _, err = time.Parse(timeFormat, parts[3]); err != nil {
-			err = fmt.Errorf("%s: %w", dateErrText, err)
-			return
+// replyLines sends the lines as a reply, splitting them into several messages if they don't fit into one
+func (b *Bot) replyLines(chatID int64, msgID int, lines []string) {
+	var text strings.Builder
+	for _, line := range lines {
+		if text.Len() > 0 && text.Len()+len(line)+1 > maxMessageLength {
+			b.reply(chatID, msgID, text.String())
+			text.Reset()
 		}
-		date = parts[3]
-		fallthrough
-	case 3:
-		if platform, android, variant, err = gapps.ParsePackageParts(parts[:3]); err != nil {
-			return
+		if text.Len() > 0 {
+			text.WriteString("\n")
 		}
+		text.WriteString(line)
+	}
+	if text.Len() > 0 {
+		b.reply(chatID, msgID, text.String())
+	}
+}
+
+// errText returns the message for the failed request, unless it was cancelled or timed out
+func (b *Bot) errText(ctx context.Context, l *i18n.Localizer, key string) string {
+	switch ctx.Err() {
+	case context.Canceled:
+		return l.T("mirror.cancelled", nil)
+	case context.DeadlineExceeded:
+		return l.T("mirror.timeout", nil)
 	default:
-		err = errors.New("bad command format")
+		return l.T(key, nil)
+	}
+}
+
+// parseErrText returns the user message for the command parsing error, suggesting the closest known value
+func (b *Bot) parseErrText(l *i18n.Localizer, err error) string {
+	class := "mirror"
+	var pe *gapps.ParseError
+	if errors.As(err, &pe) && pe.Part != gapps.PartArgs {
+		class = string(pe.Part)
+	}
+	b.obs.ParseError(class)
+
+	text := l.T("errors."+class, nil)
+	if pe != nil && pe.Suggestion != "" {
+		text += "\n" + l.T("errors.suggestion", i18n.Args{"value": pe.Suggestion})
+	}
+	return text
+}
+
+// parseCmd parses the package and the optional release date from the command args
+func parseCmd(parts []string, timeFormat string) (platform gapps.Platform, android gapps.Android, variant gapps.Variant, date string, err error) {
+	q, err := gapps.Parse(parts, timeFormat)
+	if err != nil {
+		return
+	}
+	if platform, android, variant, err = q.Package(); err != nil {
+		return
+	}
+	return platform, android, variant, releaseDate(q), nil
+}
+
+// releaseDate returns the storage date of the query, defaulting to the current storage
+func releaseDate(q *gapps.Query) string {
+	if q.Date == "" {
+		return storage.CurrentStorageKey
 	}
-	return
+	return q.Date
 }
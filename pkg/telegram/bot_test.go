@@ -0,0 +1,42 @@
+package telegram
+
+import (
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestCommands(t *testing.T) {
+	cfg := viper.New()
+	for _, name := range []string{"start", "help", "mirror", "subscribe", "unsubscribe", "cancel", "language",
+		"dates", "list", "diff", "refresh", "storages", "purge", "remirror", "stats", "ban", "unban"} {
+		cfg.Set("commands."+name, "/"+name)
+	}
+	cfg.Set("commands.mirror", "/get")
+	commands := (&Bot{cfg: cfg}).newCommands()
+
+	tests := []struct {
+		text  string
+		name  string
+		admin bool
+	}{
+		{"/get arm64 10.0 nano", "mirror", false},
+		{"/get@opengapps_bot arm64", "mirror", false},
+		{"/subscribe", "subscribe", false},
+		{"/unsubscribe all", "unsubscribe", false},
+		{"/stats", "stats", true},
+		{"/unban 42", "unban", true},
+		// the command is only taken as a whole word
+		{"/mirror arm64", "", false},
+		{"/getter", "", false},
+		{"/ban42", "", false},
+		{"get arm64", "", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		cmd, ok := commands[commandName(tt.text)]
+		if ok != (tt.name != "") || cmd.name != tt.name || cmd.admin != tt.admin {
+			t.Errorf("command of %q = %q (admin %t), want %q (admin %t)", tt.text, cmd.name, cmd.admin, tt.name, tt.admin)
+		}
+	}
+}
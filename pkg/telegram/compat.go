@@ -0,0 +1,43 @@
+package telegram
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/nezorflame/opengapps-mirror-bot/internal/pkg/i18n"
+	"github.com/nezorflame/opengapps-mirror-bot/internal/pkg/storage"
+	"github.com/nezorflame/opengapps-mirror-bot/pkg/gapps"
+)
+
+// missingText explains why the package is missing in the Storage and suggests the closest available one
+func (b *Bot) missingText(l *i18n.Localizer, s *storage.Storage, c gapps.Combo) string {
+	var ce *gapps.CompatError
+	if s.Matrix == nil || !errors.As(s.Matrix.Check(c), &ce) {
+		return l.T("mirror.not_found", nil)
+	}
+
+	args := i18n.Args{
+		"date":     s.Date,
+		"platform": c.Platform,
+		"android":  c.Android.HumanString(),
+		"variant":  c.Variant,
+	}
+	if ce.Reason == gapps.ReasonCombination {
+		androids := s.Matrix.Androids(c.Platform, c.Variant)
+		names := make([]string, len(androids))
+		for i, a := range androids {
+			names[i] = a.HumanString()
+		}
+		args["androids"] = strings.Join(names, ", ")
+	}
+	text := l.T("compat."+string(ce.Reason), args)
+
+	if ce.Closest != nil {
+		cmd := []string{b.cfg.GetString("commands.mirror"), ce.Closest.Platform.String(), ce.Closest.Android.HumanString(), ce.Closest.Variant.String()}
+		if s.Date != "" {
+			cmd = append(cmd, s.Date)
+		}
+		text += "\n" + l.T("compat.closest", i18n.Args{"command": strings.Join(cmd, " ")})
+	}
+	return text
+}
@@ -0,0 +1,161 @@
+package telegram
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/nezorflame/opengapps-mirror-bot/internal/pkg/i18n"
+	"github.com/nezorflame/opengapps-mirror-bot/internal/pkg/storage"
+	"github.com/nezorflame/opengapps-mirror-bot/pkg/gapps"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	log "github.com/sirupsen/logrus"
+)
+
+const datesMaxCount = 100
+
+// dates lists the release dates available on Github, either for all the platforms or for the provided one
+func (b *Bot) dates(msg *tgbotapi.Message) {
+	logger := log.WithField("chat_id", msg.Chat.ID).WithField("msg_id", msg.MessageID)
+	l := b.lang(msg.From)
+	ctx, done := b.tasks.start(b.ctx, msg.Chat.ID, b.cfg.GetDuration("gapps.mirror_timeout"))
+	defer done()
+
+	var dates []string
+	q, err := gapps.Parse(strings.Fields(msg.Text)[1:], b.cfg.GetString("gapps.time_format"))
+	switch {
+	case err != nil:
+		b.reply(msg.Chat.ID, msg.MessageID, b.parseErrText(l, err))
+		return
+	case q.Android != nil || q.Variant != nil || q.Date != "":
+		b.reply(msg.Chat.ID, msg.MessageID, l.T("dates.usage", nil))
+		return
+	case q.Platform != nil:
+		dates, err = b.releases.Dates(ctx, *q.Platform)
+	default:
+		dates, err = b.releases.AllDates(ctx)
+	}
+	if err != nil {
+		logger.Errorf("Unable to get the release dates: %v", err)
+		b.reply(msg.Chat.ID, msg.MessageID, b.errText(ctx, l, "errors.unknown"))
+		return
+	}
+	if len(dates) == 0 {
+		b.reply(msg.Chat.ID, msg.MessageID, l.T("dates.empty", nil))
+		return
+	}
+
+	more := len(dates) - datesMaxCount
+	if more > 0 {
+		dates = dates[:datesMaxCount]
+	}
+	text := l.T("dates.list", i18n.Args{"dates": "`" + strings.Join(dates, "`, `") + "`"})
+	if more > 0 {
+		text += "\n" + l.N("dates.more", more, nil)
+	}
+	b.reply(msg.Chat.ID, msg.MessageID, text)
+}
+
+// list shows the package variants available in the release, optionally filtered by the platform and Android version
+func (b *Bot) list(msg *tgbotapi.Message) {
+	l := b.lang(msg.From)
+	parts := strings.Fields(msg.Text)
+	if len(parts) < 2 {
+		b.reply(msg.Chat.ID, msg.MessageID, l.T("list.usage", nil))
+		return
+	}
+
+	date, platform, android, err := parseListArgs(parts[1:], b.cfg.GetString("gapps.time_format"))
+	if err != nil {
+		b.reply(msg.Chat.ID, msg.MessageID, b.parseErrText(l, err))
+		return
+	}
+
+	ctx, done := b.tasks.start(b.ctx, msg.Chat.ID, b.cfg.GetDuration("gapps.mirror_timeout"))
+	defer done()
+	date, matrix, ok := b.fetchMatrix(ctx, l, msg.Chat.ID, msg.MessageID, date)
+	if !ok {
+		return
+	}
+
+	var (
+		lines []string
+		names []string
+	)
+	combos := matrix.Combos()
+	for i, c := range combos {
+		if platform != nil && c.Platform != *platform || android != nil && c.Android != *android {
+			continue
+		}
+		names = append(names, c.Variant.String())
+		// the combinations are ordered, so the variants of the platform and Android version are adjacent
+		if i+1 < len(combos) && combos[i+1].Platform == c.Platform && combos[i+1].Android == c.Android {
+			continue
+		}
+		lines = append(lines, l.T("list.entry", i18n.Args{
+			"platform": c.Platform,
+			"android":  c.Android.HumanString(),
+			"variants": strings.Join(names, ", "),
+		}))
+		names = nil
+	}
+	if len(lines) == 0 {
+		b.reply(msg.Chat.ID, msg.MessageID, l.T("list.empty", i18n.Args{"date": date}))
+		return
+	}
+	b.reply(msg.Chat.ID, msg.MessageID, l.T("list.packages", i18n.Args{"date": date, "packages": strings.Join(lines, "\n")}))
+}
+
+// fetchMatrix returns the release date and the package combinations built for it,
+// taking them from the known Storage or parsing the release asset names on Github otherwise.
+// The user is notified about the errors, so the caller only has to return if it fails.
+func (b *Bot) fetchMatrix(ctx context.Context, l *i18n.Localizer, chatID int64, msgID int, date string) (string, *gapps.Matrix, bool) {
+	if s, ok := b.gs.Get(date); ok && s.Matrix != nil {
+		return s.Date, s.Matrix, true
+	}
+
+	logger := log.WithField("chat_id", chatID).WithField("msg_id", msgID).WithField("release_date", date)
+	if exists, err := b.releases.Exists(ctx, date); err != nil {
+		logger.Warnf("Unable to check the release date: %v", err)
+	} else if !exists {
+		b.reply(chatID, msgID, l.T("dates.unknown", i18n.Args{"date": date}))
+		return "", nil, false
+	}
+
+	releaseDate, matrix, err := storage.GetReleaseMatrix(ctx, b.gh, b.cfg, date)
+	switch {
+	case errors.Is(err, storage.ErrStorageNotFound):
+		b.reply(chatID, msgID, l.T("dates.unknown", i18n.Args{"date": date}))
+		return "", nil, false
+	case err != nil:
+		logger.Errorf("Unable to get the release packages: %v", err)
+		b.reply(chatID, msgID, b.errText(ctx, l, "errors.unknown"))
+		return "", nil, false
+	}
+	return releaseDate, matrix, true
+}
+
+// parseListArgs parses the release date (the current one by default) and the optional platform and Android version
+func parseListArgs(args []string, timeFormat string) (date string, platform *gapps.Platform, android *gapps.Android, err error) {
+	q, err := gapps.Parse(args, timeFormat)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	if q.Variant != nil {
+		return "", nil, nil, &gapps.ParseError{Part: gapps.PartArgs, Arg: q.Variant.String()}
+	}
+	return releaseDate(q), q.Platform, q.Android, nil
+}
+
+// parseDate parses the single release date argument
+func parseDate(arg, timeFormat string) (string, error) {
+	q, err := gapps.Parse([]string{arg}, timeFormat)
+	if err != nil {
+		return "", err
+	}
+	if q.Platform != nil || q.Android != nil || q.Variant != nil {
+		return "", &gapps.ParseError{Part: gapps.PartDate, Arg: arg}
+	}
+	return releaseDate(q), nil
+}
@@ -0,0 +1,90 @@
+package telegram
+
+import (
+	"strings"
+
+	"github.com/nezorflame/opengapps-mirror-bot/internal/pkg/i18n"
+	"github.com/nezorflame/opengapps-mirror-bot/internal/pkg/storage"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// diff compares the packages of two releases
+func (b *Bot) diff(msg *tgbotapi.Message) {
+	l := b.lang(msg.From)
+	parts := strings.Fields(msg.Text)
+	if len(parts) != 3 || msg.From == nil {
+		b.reply(msg.Chat.ID, msg.MessageID, l.T("diff.usage", nil))
+		return
+	}
+	dates := make([]string, len(parts)-1)
+	for i, arg := range parts[1:] {
+		date, err := parseDate(arg, b.cfg.GetString("gapps.time_format"))
+		if err != nil {
+			b.reply(msg.Chat.ID, msg.MessageID, b.parseErrText(l, err))
+			return
+		}
+		dates[i] = date
+	}
+
+	ctx, done := b.tasks.start(b.ctx, msg.Chat.ID, b.cfg.GetDuration("gapps.mirror_timeout"))
+	defer done()
+	from, ok := b.fetchStorage(ctx, l, msg.From.ID, msg.Chat.ID, msg.MessageID, dates[0])
+	if !ok {
+		return
+	}
+	to, ok := b.fetchStorage(ctx, l, msg.From.ID, msg.Chat.ID, msg.MessageID, dates[1])
+	if !ok {
+		return
+	}
+
+	changes := storage.Diff(from, to)
+	if len(changes) == 0 {
+		b.reply(msg.Chat.ID, msg.MessageID, l.T("diff.none", i18n.Args{"from": from.Date, "to": to.Date}))
+		return
+	}
+
+	counts := make(map[storage.ChangeKind]int)
+	lines := make([]string, len(changes))
+	for i, c := range changes {
+		counts[c.Kind]++
+		lines[i] = changeText(l, c)
+	}
+	header := l.T("diff.summary", i18n.Args{
+		"from":      from.Date,
+		"to":        to.Date,
+		"added":     counts[storage.ChangeAdded],
+		"removed":   counts[storage.ChangeRemoved],
+		"changed":   counts[storage.ChangeUpdated],
+		"unchanged": to.Len() - counts[storage.ChangeAdded] - counts[storage.ChangeUpdated],
+	})
+	b.replyLines(msg.Chat.ID, msg.MessageID, append([]string{header}, lines...))
+}
+
+// changeText returns the line describing the package change
+func changeText(l *i18n.Localizer, c *storage.Change) string {
+	name := strings.Join([]string{c.Platform.String(), c.Android.HumanString(), c.Variant.String()}, " ")
+	switch c.Kind {
+	case storage.ChangeAdded:
+		return l.T("diff.added", i18n.Args{"package": name, "size": formatSize(int64(c.New.Size))})
+	case storage.ChangeRemoved:
+		return l.T("diff.removed", i18n.Args{"package": name, "size": formatSize(int64(c.Old.Size))})
+	}
+
+	var details []string
+	if delta := c.SizeDelta(); delta != 0 {
+		sign := "+"
+		if delta < 0 {
+			sign, delta = "-", -delta
+		}
+		details = append(details, l.T("diff.size", i18n.Args{
+			"old":   formatSize(int64(c.Old.Size)),
+			"new":   formatSize(int64(c.New.Size)),
+			"delta": sign + formatSize(int64(delta)),
+		}))
+	}
+	if c.ChecksumChanged() {
+		details = append(details, l.T("diff.checksum", nil))
+	}
+	return l.T("diff.changed", i18n.Args{"package": name, "details": strings.Join(details, ", ")})
+}
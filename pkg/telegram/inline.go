@@ -0,0 +1,157 @@
+package telegram
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nezorflame/opengapps-mirror-bot/internal/pkg/i18n"
+	"github.com/nezorflame/opengapps-mirror-bot/internal/pkg/jobs"
+	"github.com/nezorflame/opengapps-mirror-bot/internal/pkg/storage"
+	"github.com/nezorflame/opengapps-mirror-bot/pkg/gapps"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	inlineSeparator  = ":"
+	inlineMaxResults = 50
+	inlineCacheTime  = 30
+)
+
+// inline answers the inline query with the packages from the storage matching the query
+func (b *Bot) inline(q *tgbotapi.InlineQuery) {
+	logger := log.WithField("user_id", q.From.ID).WithField("query", q.Query)
+
+	date, tokens := storage.CurrentStorageKey, make([]string, 0, 4)
+	for _, t := range strings.Fields(strings.ToLower(strings.Replace(q.Query, ".", "", -1))) {
+		if _, err := time.Parse(b.cfg.GetString("gapps.time_format"), t); err == nil {
+			date = t
+			continue
+		}
+		tokens = append(tokens, t)
+	}
+
+	l := b.lang(q.From)
+	results := make([]interface{}, 0, inlineMaxResults)
+	if s, ok := b.gs.Get(date); ok {
+		for _, pkg := range s.List() {
+			if !matchPackage(pkg, tokens) {
+				continue
+			}
+			results = append(results, b.inlineResult(l, date, pkg))
+			if len(results) == inlineMaxResults {
+				break
+			}
+		}
+	}
+
+	answer := tgbotapi.InlineConfig{
+		InlineQueryID: q.ID,
+		Results:       results,
+		CacheTime:     inlineCacheTime,
+	}
+	if _, err := b.api.Request(answer); err != nil {
+		logger.Errorf("Unable to answer the inline query: %v", err)
+		return
+	}
+	logger.Debugf("Sent %d inline results", len(results))
+}
+
+// chosenInline creates the missing mirrors for the chosen inline result and updates the sent message
+func (b *Bot) chosenInline(r *tgbotapi.ChosenInlineResult) {
+	logger := log.WithField("user_id", r.From.ID).WithField("result_id", r.ResultID)
+
+	parts := strings.Split(r.ResultID, inlineSeparator)
+	if len(parts) != 4 {
+		logger.Warn("Bad inline result ID")
+		return
+	}
+
+	s, ok := b.gs.Get(parts[0])
+	if !ok {
+		logger.Warn("Storage for the inline result is not found")
+		return
+	}
+
+	platform, android, variant, err := gapps.ParsePackageParts(parts[1:])
+	if err != nil {
+		logger.Warnf("Unable to parse the inline result: %v", err)
+		return
+	}
+
+	pkg, ok := s.Get(platform, android, variant)
+	if !ok || pkg.HasMirrors() {
+		return
+	}
+
+	l := b.lang(r.From)
+	if text, ok := b.downloadAllowed(l, r.From.ID); !ok {
+		b.newStatus(l, 0, 0, r.InlineMessageID, "").finish(text)
+		return
+	}
+
+	logger.Debugf("Creating a mirror for the package %s", pkg.Name)
+	ctx, cancel := context.WithTimeout(b.ctx, b.cfg.GetDuration("gapps.mirror_timeout"))
+	defer cancel()
+	b.runJob(ctx, s, pkg, jobs.Request{InlineMessageID: r.InlineMessageID, Locale: l.Locale()})
+}
+
+func (b *Bot) inlineResult(l *i18n.Localizer, date string, pkg *storage.Package) tgbotapi.InlineQueryResultArticle {
+	id := strings.Join([]string{date, pkg.Platform.String(), pkg.Android.String(), pkg.Variant.String()}, inlineSeparator)
+	result := tgbotapi.NewInlineQueryResultArticleMarkdown(id, pkg.Name, b.packageText(l, pkg))
+	result.Description = fmt.Sprintf("MD5: %s", pkg.MD5)
+
+	// reply markup is required to receive the inline message ID for the chosen result
+	markup := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonURL("Github", pkg.OriginURL)),
+	)
+	result.ReplyMarkup = &markup
+	return result
+}
+
+// packageText returns the package description with either its mirrors or the missing mirror note
+func (b *Bot) packageText(l *i18n.Localizer, pkg *storage.Package) string {
+	status := l.T("mirror.missing", nil)
+	if links := b.mirrorLinks(pkg); links != "" {
+		status = l.T("mirror.ok", i18n.Args{"links": links})
+	}
+	return b.packageStatusText(l, pkg, status)
+}
+
+// packageStatusText returns the package description with the provided status
+func (b *Bot) packageStatusText(l *i18n.Localizer, pkg *storage.Package, status string) string {
+	return l.T("mirror.found", i18n.Args{
+		"name":      pkg.Name,
+		"url":       pkg.OriginURL,
+		"checksums": b.checksumsText(l, pkg),
+		"status":    status,
+	})
+}
+
+// checksumsText returns the lines with the known package checksums
+func (b *Bot) checksumsText(l *i18n.Localizer, pkg *storage.Package) string {
+	sums := pkg.Checksums()
+	lines := []string{l.T("mirror.md5", i18n.Args{"md5": sums.MD5})}
+	if sums.SHA1 != "" {
+		lines = append(lines, l.T("mirror.sha1", i18n.Args{"sha1": sums.SHA1}))
+	}
+	if sums.SHA256 != "" {
+		lines = append(lines, l.T("mirror.sha256", i18n.Args{"sha256": sums.SHA256}))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// matchPackage checks if every token is a prefix of one of the package parts
+func matchPackage(pkg *storage.Package, tokens []string) bool {
+	for _, t := range tokens {
+		if !strings.HasPrefix(pkg.Platform.String(), t) &&
+			!strings.HasPrefix(pkg.Android.String(), t) &&
+			!strings.HasPrefix(pkg.Variant.String(), t) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,142 @@
+package telegram
+
+import (
+	"context"
+	"sync"
+
+	"github.com/nezorflame/opengapps-mirror-bot/internal/pkg/jobs"
+	"github.com/nezorflame/opengapps-mirror-bot/internal/pkg/storage"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// runJob creates the package mirror for the request, keeping it in the job queue until it's finished.
+// If the bot is stopped meanwhile, the request stays in the queue and is replayed on the next start.
+func (b *Bot) runJob(ctx context.Context, s *storage.Storage, pkg *storage.Package, req jobs.Request) {
+	logger := log.WithField("chat_id", req.ChatID).WithField("msg_id", req.MessageID).WithField("package", pkg.Name)
+	key := storage.PackageKey{Platform: pkg.Platform, Android: pkg.Android, Variant: pkg.Variant}
+	if err := b.jobs.Add(s.Date, key, req); err != nil {
+		logger.Errorf("Unable to save the job: %v", err)
+	}
+
+	l := b.tr.Localizer(req.Locale)
+	text := b.packageText(l, pkg)
+	st := b.newStatus(l, req.ChatID, req.StatusID, req.InlineMessageID, text)
+	logger.Debug("Creating a mirror for the package")
+	err := pkg.CreateMirror(ctx, b.dq, b.ups, st.update)
+	if err != nil && b.ctx.Err() != nil {
+		logger.Warnf("Mirroring is interrupted by shutdown, the job is left for replay: %v", err)
+		st.stop()
+		return
+	}
+	if jobErr := b.jobs.Done(s.Date, key, req); jobErr != nil {
+		logger.Errorf("Unable to remove the job: %v", jobErr)
+	}
+
+	if err != nil {
+		logger.Errorf("Unable to create mirror: %v", err)
+		if req.InlineMessageID != "" {
+			st.finish(b.errText(ctx, l, "mirror.fail"))
+			return
+		}
+		st.finish(text)
+		b.reply(req.ChatID, req.MessageID, b.errText(ctx, l, "mirror.fail"))
+		return
+	}
+
+	if err = s.Save(); err != nil {
+		logger.Errorf("Unable to save storage: %v", err)
+	}
+	st.finish(b.packageText(l, pkg))
+	logger.Info("Sent mirror for the package")
+}
+
+// Resume replays the mirror jobs left unfinished by the previous run,
+// so that the waiting users still get their mirrors
+func (b *Bot) Resume() {
+	pending, err := b.jobs.Reset()
+	if err != nil {
+		log.Errorf("Unable to load the unfinished jobs: %v", err)
+		return
+	}
+	log.Infof("Resuming %d unfinished jobs", len(pending))
+
+	replay(pending, b.jobStorage, b.dropJob, func(s *storage.Storage, pkg *storage.Package, req jobs.Request) {
+		var (
+			ctx  context.Context
+			done func()
+		)
+		if req.InlineMessageID != "" {
+			ctx, done = context.WithTimeout(b.ctx, b.cfg.GetDuration("gapps.mirror_timeout"))
+		} else {
+			ctx, done = b.tasks.start(b.ctx, req.ChatID, b.cfg.GetDuration("gapps.mirror_timeout"))
+		}
+		defer done()
+		b.runJob(ctx, s, pkg, req)
+	})
+}
+
+// jobStorage returns the Storage of the replayed job, getting it from Github if it's not known yet
+func (b *Bot) jobStorage(date string) (*storage.Storage, error) {
+	if s, ok := b.gs.Get(date); ok {
+		return s, nil
+	}
+	s, err := storage.GetPackageStorage(b.ctx, b.gh, b.dq, b.cfg, date)
+	if err != nil {
+		return nil, err
+	}
+	return b.gs.AddIfMissing(s), nil
+}
+
+// replay starts every request of the pending jobs with run, each one in its own goroutine.
+// The storages are resolved once per release date and concurrently, so that a slow release doesn't hold the others back.
+// The jobs without the storage or the package are dropped.
+func replay(pending []*jobs.Job, get func(date string) (*storage.Storage, error), drop func(*jobs.Job),
+	run func(*storage.Storage, *storage.Package, jobs.Request)) {
+	byDate := make(map[string][]*jobs.Job)
+	for _, j := range pending {
+		byDate[j.Date] = append(byDate[j.Date], j)
+	}
+
+	var wg sync.WaitGroup
+	for date, dateJobs := range byDate {
+		wg.Add(1)
+		go func(date string, dateJobs []*jobs.Job) {
+			defer wg.Done()
+			logger := log.WithField("release_date", date)
+			s, err := get(date)
+			if err != nil {
+				logger.Errorf("Unable to get package storage, dropping %d jobs: %v", len(dateJobs), err)
+				for _, j := range dateJobs {
+					drop(j)
+				}
+				return
+			}
+
+			for _, j := range dateJobs {
+				pkg, ok := s.Get(j.Platform, j.Android, j.Variant)
+				if !ok {
+					logger.WithField("package", j.PackageKey).Warn("Package for the job is not found, dropping it")
+					drop(j)
+					continue
+				}
+				for _, req := range j.Requests {
+					wg.Add(1)
+					go func(req jobs.Request) {
+						defer wg.Done()
+						run(s, pkg, req)
+					}(req)
+				}
+			}
+		}(date, dateJobs)
+	}
+	wg.Wait()
+}
+
+func (b *Bot) dropJob(j *jobs.Job) {
+	for _, req := range j.Requests {
+		if err := b.jobs.Done(j.Date, j.PackageKey, req); err != nil {
+			log.Errorf("Unable to remove the job: %v", err)
+		}
+	}
+}
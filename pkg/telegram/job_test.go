@@ -0,0 +1,147 @@
+package telegram
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nezorflame/opengapps-mirror-bot/internal/pkg/db"
+	"github.com/nezorflame/opengapps-mirror-bot/internal/pkg/jobs"
+	"github.com/nezorflame/opengapps-mirror-bot/internal/pkg/storage"
+	"github.com/nezorflame/opengapps-mirror-bot/pkg/gapps"
+)
+
+func TestReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "telegram-test")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "bolt.db")
+
+	var (
+		nano    = storage.PackageKey{Platform: gapps.PlatformArm64, Android: gapps.Android100, Variant: gapps.VariantNano}
+		pico    = storage.PackageKey{Platform: gapps.PlatformArm64, Android: gapps.Android100, Variant: gapps.VariantPico}
+		first   = jobs.Request{ChatID: 1, MessageID: 10}
+		second  = jobs.Request{ChatID: 2, MessageID: 20}
+		unknown = jobs.Request{ChatID: 3, MessageID: 30}
+		missing = jobs.Request{ChatID: 4, MessageID: 40}
+	)
+
+	// the jobs are left running by the previous run
+	cache, store := openJobs(t, path)
+	for _, j := range []struct {
+		date string
+		key  storage.PackageKey
+		req  jobs.Request
+	}{
+		{"20200101", nano, first},
+		{"20200101", nano, second},
+		{"20200101", pico, unknown},
+		{"20200102", nano, missing},
+	} {
+		if err = store.Add(j.date, j.key, j.req); err != nil {
+			t.Fatalf("unable to add job: %v", err)
+		}
+	}
+	if err = cache.Close(false); err != nil {
+		t.Fatalf("unable to close DB: %v", err)
+	}
+
+	// restart
+	cache, store = openJobs(t, path)
+	defer cache.Close(false)
+	pending, err := store.Reset()
+	if err != nil {
+		t.Fatalf("unable to reset jobs: %v", err)
+	}
+	if len(pending) != 3 {
+		t.Fatalf("got %d pending jobs, want 3", len(pending))
+	}
+
+	s := &storage.Storage{Packages: make(map[gapps.Platform]map[gapps.Android]map[gapps.Variant]*storage.Package)}
+	s.Add(&storage.Package{Name: "nano", Date: "20200101", Platform: nano.Platform, Android: nano.Android, Variant: nano.Variant})
+
+	var (
+		gets = make(map[string]int)
+		ran  []jobs.Request
+		mtx  sync.Mutex
+	)
+	get := func(date string) (*storage.Storage, error) {
+		mtx.Lock()
+		gets[date]++
+		mtx.Unlock()
+		if date != "20200101" {
+			return nil, errors.New("unknown release")
+		}
+		return s, nil
+	}
+	drop := func(j *jobs.Job) {
+		for _, req := range j.Requests {
+			if err := store.Done(j.Date, j.PackageKey, req); err != nil {
+				t.Errorf("unable to drop job: %v", err)
+			}
+		}
+	}
+	run := func(rs *storage.Storage, pkg *storage.Package, req jobs.Request) {
+		mtx.Lock()
+		defer mtx.Unlock()
+		if rs != s || pkg.Variant != gapps.VariantNano {
+			t.Errorf("request %+v is replayed with the wrong package %s", req, pkg.Name)
+		}
+		ran = append(ran, req)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		replay(pending, get, drop, run)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("replay is stuck")
+	}
+
+	if gets["20200101"] != 1 || gets["20200102"] != 1 {
+		t.Errorf("storages are resolved %v times, want once per date", gets)
+	}
+	if len(ran) != 2 || !hasRequest(ran, first) || !hasRequest(ran, second) {
+		t.Errorf("replayed requests = %+v, want %+v and %+v", ran, first, second)
+	}
+
+	// only the replayed job is left in the store
+	left, err := store.Reset()
+	if err != nil {
+		t.Fatalf("unable to reset jobs: %v", err)
+	}
+	if len(left) != 1 || left[0].PackageKey != nano || left[0].Date != "20200101" {
+		t.Errorf("jobs left after replay = %+v, want the replayed one only", left)
+	}
+}
+
+func openJobs(t *testing.T, path string) (*db.DB, *jobs.Store) {
+	t.Helper()
+	cache, err := db.NewDB(path, time.Second)
+	if err != nil {
+		t.Fatalf("unable to open DB: %v", err)
+	}
+	store, err := jobs.NewStore(cache)
+	if err != nil {
+		t.Fatalf("unable to init jobs store: %v", err)
+	}
+	return cache, store
+}
+
+func hasRequest(reqs []jobs.Request, req jobs.Request) bool {
+	for _, r := range reqs {
+		if r == req {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,64 @@
+package telegram
+
+import (
+	"strings"
+
+	"github.com/nezorflame/opengapps-mirror-bot/internal/pkg/i18n"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	log "github.com/sirupsen/logrus"
+)
+
+const languageAuto = "auto"
+
+// lang returns the Localizer for the user: the locale chosen with the language command,
+// or the language of the user's Telegram client otherwise
+func (b *Bot) lang(u *tgbotapi.User) *i18n.Localizer {
+	if u == nil {
+		return b.tr.Localizer("")
+	}
+
+	locale, err := b.locales.Get(u.ID)
+	if err != nil {
+		log.WithField("user_id", u.ID).Errorf("Unable to get the user locale: %v", err)
+	}
+	if locale == "" {
+		locale = u.LanguageCode
+	}
+	return b.tr.Localizer(locale)
+}
+
+// language shows or sets the locale of the user, "auto" resets it to the language of the Telegram client
+func (b *Bot) language(msg *tgbotapi.Message) {
+	logger := log.WithField("chat_id", msg.Chat.ID).WithField("msg_id", msg.MessageID)
+	l := b.lang(msg.From)
+	parts := strings.Fields(msg.Text)
+	if len(parts) != 2 || msg.From == nil {
+		b.reply(msg.Chat.ID, msg.MessageID, l.T("language.usage", i18n.Args{
+			"locale":  l.Locale(),
+			"locales": "`" + strings.Join(b.tr.Locales(), "`, `") + "`",
+		}))
+		return
+	}
+
+	var err error
+	if strings.ToLower(parts[1]) == languageAuto {
+		err = b.locales.Reset(msg.From.ID)
+	} else {
+		locale, ok := b.tr.Match(parts[1])
+		if !ok {
+			b.reply(msg.Chat.ID, msg.MessageID, l.T("language.unknown", i18n.Args{"locale": parts[1]}))
+			return
+		}
+		err = b.locales.Set(msg.From.ID, locale)
+	}
+	if err != nil {
+		logger.Errorf("Unable to save the user locale: %v", err)
+		b.reply(msg.Chat.ID, msg.MessageID, l.T("errors.unknown", nil))
+		return
+	}
+
+	l = b.lang(msg.From)
+	b.reply(msg.Chat.ID, msg.MessageID, l.T("language.ok", i18n.Args{"locale": l.Locale()}))
+	logger.Infof("Set the locale %s", l.Locale())
+}
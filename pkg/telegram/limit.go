@@ -0,0 +1,146 @@
+package telegram
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nezorflame/opengapps-mirror-bot/internal/pkg/i18n"
+	"github.com/nezorflame/opengapps-mirror-bot/internal/pkg/ratelimit"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// limits keeps the rate limiters of the bot, see the 'limits' config section
+type limits struct {
+	user     *ratelimit.Limiter
+	chat     *ratelimit.Limiter
+	download *ratelimit.Limiter
+}
+
+func newLimits(cfg *viper.Viper) *limits {
+	return &limits{
+		user:     ratelimit.New(cfg.GetInt("limits.user.requests"), cfg.GetDuration("limits.user.period")),
+		chat:     ratelimit.New(cfg.GetInt("limits.chat.requests"), cfg.GetDuration("limits.chat.period")),
+		download: ratelimit.New(cfg.GetInt("limits.download.requests"), cfg.GetDuration("limits.download.period")),
+	}
+}
+
+// allowed checks if the update of the user in the chat (if any) should be handled.
+// It refuses the banned users and the ones exceeding the rate limits, the latter are banned
+// after 'limits.ban_after' consecutive throttled requests. The throttled message is only returned
+// for the first of the consecutive throttled requests, so that the spammers don't get a reply to every one.
+func (b *Bot) allowed(user *tgbotapi.User, chatID int64) (string, bool) {
+	userID := user.ID
+	if b.isAdmin(userID) {
+		return "", true
+	}
+
+	logger := log.WithField("user_id", userID).WithField("chat_id", chatID)
+	banned, err := b.bans.Banned(userID)
+	if err != nil {
+		logger.Errorf("Unable to check the ban: %v", err)
+	}
+	if banned {
+		logger.Debug("Ignoring the banned user")
+		return "", false
+	}
+
+	wait, count := b.limits.user.Allow(int64(userID))
+	if wait > 0 {
+		b.obs.Throttled("user")
+		if banAfter := b.cfg.GetInt("limits.ban_after"); banAfter > 0 && count >= banAfter {
+			logger.Warnf("Banning the user after %d throttled requests", count)
+			if err = b.bans.Add(userID, "rate limit"); err != nil {
+				logger.Errorf("Unable to ban the user: %v", err)
+			}
+			return "", false
+		}
+	} else if chatID != 0 {
+		if wait, count = b.limits.chat.Allow(chatID); wait > 0 {
+			b.obs.Throttled("chat")
+		}
+	}
+
+	if wait == 0 {
+		return "", true
+	}
+	logger.Debugf("Throttled the request for %s", wait)
+	if count > 1 {
+		return "", false
+	}
+	return b.throttledText(b.lang(user), wait), false
+}
+
+// downloadAllowed checks the stricter rate limit of the user for the requests which trigger the downloads
+func (b *Bot) downloadAllowed(l *i18n.Localizer, userID int) (string, bool) {
+	if b.isAdmin(userID) {
+		return "", true
+	}
+
+	wait, _ := b.limits.download.Allow(int64(userID))
+	if wait == 0 {
+		return "", true
+	}
+	b.obs.Throttled("download")
+	log.WithField("user_id", userID).Debugf("Throttled the download for %s", wait)
+	return b.throttledText(l, wait), false
+}
+
+func (b *Bot) throttledText(l *i18n.Localizer, wait time.Duration) string {
+	if wait < time.Second {
+		wait = time.Second
+	}
+	return l.T("limits.throttled", i18n.Args{"wait": wait.Round(time.Second)})
+}
+
+// ban bans the user by ID
+func (b *Bot) ban(msg *tgbotapi.Message) {
+	l := b.lang(msg.From)
+	userID, ok := b.banArgs(l, msg)
+	if !ok {
+		return
+	}
+	if err := b.bans.Add(userID, "admin"); err != nil {
+		log.WithField("chat_id", msg.Chat.ID).Errorf("Unable to ban the user: %v", err)
+		b.reply(msg.Chat.ID, msg.MessageID, l.T("errors.unknown", nil))
+		return
+	}
+	log.WithField("user_id", userID).Info("Banned the user")
+	b.reply(msg.Chat.ID, msg.MessageID, l.T("ban.ok", i18n.Args{"user_id": userID}))
+}
+
+// unban unbans the user by ID
+func (b *Bot) unban(msg *tgbotapi.Message) {
+	l := b.lang(msg.From)
+	userID, ok := b.banArgs(l, msg)
+	if !ok {
+		return
+	}
+	removed, err := b.bans.Remove(userID)
+	if err != nil {
+		log.WithField("chat_id", msg.Chat.ID).Errorf("Unable to unban the user: %v", err)
+		b.reply(msg.Chat.ID, msg.MessageID, l.T("errors.unknown", nil))
+		return
+	}
+	if !removed {
+		b.reply(msg.Chat.ID, msg.MessageID, l.T("unban.none", i18n.Args{"user_id": userID}))
+		return
+	}
+	log.WithField("user_id", userID).Info("Unbanned the user")
+	b.reply(msg.Chat.ID, msg.MessageID, l.T("unban.ok", i18n.Args{"user_id": userID}))
+}
+
+// banArgs parses the user ID of the ban commands, replying with the usage if it's missing
+func (b *Bot) banArgs(l *i18n.Localizer, msg *tgbotapi.Message) (int, bool) {
+	parts := strings.Fields(msg.Text)
+	if len(parts) == 2 {
+		if userID, err := strconv.Atoi(parts[1]); err == nil {
+			return userID, true
+		}
+	}
+	b.reply(msg.Chat.ID, msg.MessageID, l.T("ban.usage", nil))
+	return 0, false
+}
@@ -0,0 +1,19 @@
+package telegram
+
+// Observer receives the events of the Bot, e.g. to record the metrics.
+// The methods are called concurrently and must not block.
+type Observer interface {
+	// Command reports the handled command or update by its name
+	Command(name string)
+	// ParseError reports the command parsing error by its class
+	ParseError(class string)
+	// Throttled reports the request throttled by the limit ("user", "chat" or "download")
+	Throttled(limit string)
+}
+
+// nopObserver is used if no Observer is set
+type nopObserver struct{}
+
+func (nopObserver) Command(string)    {}
+func (nopObserver) ParseError(string) {}
+func (nopObserver) Throttled(string)  {}
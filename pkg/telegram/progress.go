@@ -0,0 +1,149 @@
+package telegram
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nezorflame/opengapps-mirror-bot/internal/pkg/i18n"
+	"github.com/nezorflame/opengapps-mirror-bot/pkg/net"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	log "github.com/sirupsen/logrus"
+)
+
+var chunkSymbols = map[net.ChunkState]string{
+	net.ChunkPending: "○",
+	net.ChunkActive:  "◐",
+	net.ChunkDone:    "●",
+	net.ChunkFailed:  "✕",
+}
+
+// status keeps a single message updated with the mirroring progress.
+// The progress is passed to its own goroutine, so that the message edits never block the transfer.
+type status struct {
+	b           *Bot
+	l           *i18n.Localizer
+	chatID      int64
+	msgID       int
+	inlineMsgID string
+	header      string
+	stage       net.Stage
+	lastEdit    time.Time
+	lastText    string
+	// progress holds only the latest progress not shown yet
+	progress chan net.Progress
+	done     chan struct{}
+	closed   bool
+	mtx      sync.Mutex
+}
+
+func (b *Bot) newStatus(l *i18n.Localizer, chatID int64, msgID int, inlineMsgID, header string) *status {
+	s := &status{
+		b:           b,
+		l:           l,
+		chatID:      chatID,
+		msgID:       msgID,
+		inlineMsgID: inlineMsgID,
+		header:      header,
+		progress:    make(chan net.Progress, 1),
+		done:        make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+// update queues the progress for the status message, replacing the one not shown yet
+func (s *status) update(p net.Progress) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if s.closed {
+		return
+	}
+
+	select {
+	case <-s.progress:
+	default:
+	}
+	s.progress <- p
+}
+
+// run edits the status message with the queued progress until the status is stopped.
+// Edits are throttled by 'telegram.progress_interval' unless the stage has changed.
+func (s *status) run() {
+	defer close(s.done)
+	for p := range s.progress {
+		if p.Stage == s.stage && time.Since(s.lastEdit) < s.b.cfg.GetDuration("telegram.progress_interval") {
+			continue
+		}
+		s.stage = p.Stage
+		s.lastEdit = time.Now()
+		s.edit(s.header + "\n\n" + s.progressText(p))
+	}
+}
+
+// stop stops the progress updates, waiting for the current edit to finish
+func (s *status) stop() {
+	s.mtx.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.progress)
+	}
+	s.mtx.Unlock()
+	<-s.done
+}
+
+// finish stops the progress updates and replaces the status message with the final text
+func (s *status) finish(text string) {
+	s.stop()
+	s.edit(text)
+}
+
+func (s *status) edit(text string) {
+	if text == s.lastText || (s.msgID == 0 && s.inlineMsgID == "") {
+		return
+	}
+	s.lastText = text
+
+	edit := tgbotapi.EditMessageTextConfig{
+		BaseEdit: tgbotapi.BaseEdit{ChatID: s.chatID, MessageID: s.msgID, InlineMessageID: s.inlineMsgID},
+		Text:     text,
+	}
+	edit.ParseMode = tgbotapi.ModeMarkdown
+	if _, err := s.b.api.Request(edit); err != nil {
+		log.WithField("chat_id", s.chatID).WithField("msg_id", s.msgID).Errorf("Unable to edit the status message: %v", err)
+	}
+}
+
+func (s *status) progressText(p net.Progress) string {
+	switch p.Stage {
+	case net.StageDownload:
+		chunks := make([]string, len(p.Chunks))
+		for i, c := range p.Chunks {
+			chunks[i] = chunkSymbols[c]
+		}
+		return s.l.T("progress.download", i18n.Args{"done": formatSize(p.Done), "total": formatSize(p.Total), "chunks": strings.Join(chunks, "")})
+	case net.StageVerify:
+		return s.l.T("progress.verify", nil)
+	case net.StageMove:
+		return s.l.T("progress.move", nil)
+	case net.StageUpload:
+		return s.l.T("progress.upload", i18n.Args{"done": formatSize(p.Done), "total": formatSize(p.Total)})
+	default:
+		return ""
+	}
+}
+
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(size)/float64(div), "KMGTPE"[exp])
+}
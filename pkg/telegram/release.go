@@ -0,0 +1,57 @@
+package telegram
+
+import (
+	"sync"
+
+	"github.com/nezorflame/opengapps-mirror-bot/internal/pkg/storage"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Release handles the new release: notifies the subscribers and pre-mirrors the selected packages in parallel.
+// The concurrent mirror jobs of the same package are coalesced, so nothing is downloaded twice.
+func (b *Bot) Release(s *storage.Storage) {
+	b.releases.Invalidate()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		s.PreMirror(b.ctx, b.dq, b.ups, b.preMirrorKeys())
+	}()
+	b.Notify(s)
+	wg.Wait()
+}
+
+// preMirrorKeys returns the packages selected by the pre-mirror policy:
+// the explicit list from config followed by the top-N most requested packages
+func (b *Bot) preMirrorKeys() []storage.PackageKey {
+	var keys []storage.PackageKey
+	for _, p := range b.cfg.GetStringSlice("gapps.premirror.packages") {
+		k, err := storage.ParsePackageKey(p)
+		if err != nil {
+			log.Warnf("Unable to parse pre-mirror package: %v", err)
+			continue
+		}
+		keys = append(keys, k)
+	}
+
+	if top := b.cfg.GetInt("gapps.premirror.top"); top > 0 {
+		topKeys, err := b.stats.Top(top)
+		if err != nil {
+			log.Errorf("Unable to get the most requested packages: %v", err)
+		}
+		keys = append(keys, topKeys...)
+	}
+
+	// remove the duplicates
+	seen := make(map[storage.PackageKey]bool, len(keys))
+	result := keys[:0]
+	for _, k := range keys {
+		if !seen[k] {
+			seen[k] = true
+			result = append(result, k)
+		}
+	}
+	return result
+}
@@ -0,0 +1,153 @@
+package telegram
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/nezorflame/opengapps-mirror-bot/internal/pkg/i18n"
+	"github.com/nezorflame/opengapps-mirror-bot/internal/pkg/storage"
+	"github.com/nezorflame/opengapps-mirror-bot/internal/pkg/subscription"
+	"github.com/nezorflame/opengapps-mirror-bot/pkg/gapps"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	log "github.com/sirupsen/logrus"
+)
+
+func (b *Bot) subscribe(msg *tgbotapi.Message) {
+	l := b.lang(msg.From)
+	logger := log.WithField("chat_id", msg.Chat.ID).WithField("msg_id", msg.MessageID)
+	parts := strings.Fields(msg.Text)
+	if len(parts) < 2 {
+		b.reply(msg.Chat.ID, msg.MessageID, l.T("subscribe.usage", nil))
+		return
+	}
+
+	sub, err := parseSubscription(msg.Chat.ID, parts[1:], b.cfg.GetString("gapps.time_format"))
+	if err != nil {
+		b.reply(msg.Chat.ID, msg.MessageID, b.parseErrText(l, err))
+		return
+	}
+
+	sub.Locale = l.Locale()
+	if err = b.subs.Add(sub); err != nil {
+		logger.Errorf("Unable to add subscription: %v", err)
+		b.reply(msg.Chat.ID, msg.MessageID, l.T("errors.unknown", nil))
+		return
+	}
+
+	b.reply(msg.Chat.ID, msg.MessageID, l.T("subscribe.ok", subscriptionArgs(sub)))
+	logger.Infof("Subscribed to %s", sub.Key())
+}
+
+func (b *Bot) unsubscribe(msg *tgbotapi.Message) {
+	l := b.lang(msg.From)
+	logger := log.WithField("chat_id", msg.Chat.ID).WithField("msg_id", msg.MessageID)
+	parts := strings.Fields(msg.Text)
+	if len(parts) == 1 {
+		count, err := b.subs.RemoveChat(msg.Chat.ID)
+		if err != nil {
+			logger.Errorf("Unable to remove subscriptions: %v", err)
+			b.reply(msg.Chat.ID, msg.MessageID, l.T("errors.unknown", nil))
+			return
+		}
+		if count == 0 {
+			b.reply(msg.Chat.ID, msg.MessageID, l.T("unsubscribe.none", nil))
+			return
+		}
+		b.reply(msg.Chat.ID, msg.MessageID, l.T("unsubscribe.all", nil))
+		logger.Infof("Unsubscribed from %d packages", count)
+		return
+	}
+
+	sub, err := parseSubscription(msg.Chat.ID, parts[1:], b.cfg.GetString("gapps.time_format"))
+	if err != nil {
+		b.reply(msg.Chat.ID, msg.MessageID, b.parseErrText(l, err))
+		return
+	}
+	if err = b.subs.Remove(sub); err != nil {
+		logger.Errorf("Unable to remove subscription: %v", err)
+		b.reply(msg.Chat.ID, msg.MessageID, l.T("errors.unknown", nil))
+		return
+	}
+	b.reply(msg.Chat.ID, msg.MessageID, l.T("unsubscribe.ok", subscriptionArgs(sub)))
+	logger.Infof("Unsubscribed from %s", sub.Key())
+}
+
+// Notify sends the packages from the new release Storage to the subscribed chats
+func (b *Bot) Notify(s *storage.Storage) {
+	logger := log.WithField("release_date", s.Date)
+	subs, err := b.subs.List()
+	if err != nil {
+		logger.Errorf("Unable to get subscriptions: %v", err)
+		return
+	}
+
+	// group the subscriptions by package, so that each mirror is created only once
+	chats := make(map[*storage.Package][]*subscription.Subscription)
+	for _, sub := range subs {
+		if pkg, ok := s.Get(sub.Platform, sub.Android, sub.Variant); ok {
+			chats[pkg] = append(chats[pkg], sub)
+		}
+	}
+	logger.Debugf("Notifying the subscribers of %d packages", len(chats))
+
+	// the mirrors are created concurrently, bounded by the download queue
+	var wg sync.WaitGroup
+	for pkg, pkgSubs := range chats {
+		wg.Add(1)
+		go func(pkg *storage.Package, pkgSubs []*subscription.Subscription) {
+			defer wg.Done()
+			b.notifyPackage(s, pkg, pkgSubs)
+		}(pkg, pkgSubs)
+	}
+	wg.Wait()
+}
+
+// notifyPackage mirrors the package of the new release, if needed, and sends it to the subscribed chats
+func (b *Bot) notifyPackage(s *storage.Storage, pkg *storage.Package, subs []*subscription.Subscription) {
+	logger := log.WithField("release_date", s.Date)
+	failed := false
+	if !pkg.HasMirrors() {
+		ctx, cancel := context.WithTimeout(b.ctx, b.cfg.GetDuration("gapps.mirror_timeout"))
+		err := pkg.CreateMirror(ctx, b.dq, b.ups, nil)
+		cancel()
+		if err != nil {
+			logger.Errorf("Unable to create mirror for the package %s: %v", pkg.Name, err)
+			failed = true
+		} else if err = s.Save(); err != nil {
+			logger.Errorf("Unable to save storage: %v", err)
+		}
+	}
+
+	for _, sub := range subs {
+		l := b.tr.Localizer(sub.Locale)
+		text := b.packageText(l, pkg)
+		if failed {
+			text = b.packageStatusText(l, pkg, l.T("mirror.fail", nil))
+		}
+		b.reply(sub.ChatID, 0, l.T("subscribe.new", i18n.Args{"date": s.Date})+"\n\n"+text)
+	}
+	logger.Infof("Sent the package %s to %d subscribers", pkg.Name, len(subs))
+}
+
+// subscriptionArgs returns the message args describing the subscription package
+func subscriptionArgs(sub *subscription.Subscription) i18n.Args {
+	return i18n.Args{"platform": sub.Platform, "android": sub.Android.HumanString(), "variant": sub.Variant}
+}
+
+// parseSubscription parses the subscription package, which can't have a release date
+func parseSubscription(chatID int64, args []string, timeFormat string) (*subscription.Subscription, error) {
+	q, err := gapps.Parse(args, timeFormat)
+	if err != nil {
+		return nil, err
+	}
+	if q.Date != "" {
+		return nil, &gapps.ParseError{Part: gapps.PartArgs, Arg: q.Date}
+	}
+	platform, android, variant, err := q.Package()
+	if err != nil {
+		return nil, err
+	}
+	return &subscription.Subscription{ChatID: chatID, Platform: platform, Android: android, Variant: variant}, nil
+}
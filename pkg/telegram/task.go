@@ -0,0 +1,73 @@
+package telegram
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// tasks keeps the cancel functions of the running chat requests
+type tasks struct {
+	next   int
+	byChat map[int64]map[int]context.CancelFunc
+	mtx    sync.Mutex
+}
+
+func newTasks() *tasks {
+	return &tasks{byChat: make(map[int64]map[int]context.CancelFunc)}
+}
+
+// start creates the request context for the chat, limited by timeout (if set).
+// done must be called when the request is finished.
+func (t *tasks) start(parent context.Context, chatID int64, timeout time.Duration) (ctx context.Context, done func()) {
+	var cancel context.CancelFunc
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(parent, timeout)
+	} else {
+		ctx, cancel = context.WithCancel(parent)
+	}
+
+	t.mtx.Lock()
+	id := t.next
+	t.next++
+	if t.byChat[chatID] == nil {
+		t.byChat[chatID] = make(map[int]context.CancelFunc)
+	}
+	t.byChat[chatID][id] = cancel
+	t.mtx.Unlock()
+
+	return ctx, func() {
+		t.mtx.Lock()
+		delete(t.byChat[chatID], id)
+		if len(t.byChat[chatID]) == 0 {
+			delete(t.byChat, chatID)
+		}
+		t.mtx.Unlock()
+		cancel()
+	}
+}
+
+// cancel aborts all the running requests of the chat and returns their count
+func (t *tasks) cancel(chatID int64) int {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	count := len(t.byChat[chatID])
+	for _, cancel := range t.byChat[chatID] {
+		cancel()
+	}
+	delete(t.byChat, chatID)
+	return count
+}
+
+// count returns the number of the running requests in all the chats
+func (t *tasks) count() int {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	count := 0
+	for _, chat := range t.byChat {
+		count += len(chat)
+	}
+	return count
+}
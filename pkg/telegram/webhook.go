@@ -0,0 +1,155 @@
+package telegram
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	log "github.com/sirupsen/logrus"
+)
+
+// Update modes
+const (
+	ModePolling = "polling"
+	ModeWebhook = "webhook"
+)
+
+const (
+	secretHeader    = "X-Telegram-Bot-Api-Secret-Token"
+	maxWebhookBody  = 1 << 20
+	shutdownTimeout = 5 * time.Second
+)
+
+// newWebhookServer creates the server for the webhook updates, it's started with webhook
+func (b *Bot) newWebhookServer() (*http.Server, error) {
+	hookURL, err := url.Parse(b.cfg.GetString("telegram.webhook.url"))
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse webhook URL: %w", err)
+	}
+
+	path := hookURL.Path
+	if path == "" {
+		path = "/"
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc(path, b.handleWebhook)
+	return &http.Server{Addr: b.cfg.GetString("telegram.webhook.listen"), Handler: mux}, nil
+}
+
+// webhook registers the webhook and starts to serve it
+func (b *Bot) webhook() (tgbotapi.UpdatesChannel, error) {
+	params := tgbotapi.Params{
+		"url":          b.cfg.GetString("telegram.webhook.url"),
+		"secret_token": b.cfg.GetString("telegram.webhook.secret"),
+	}
+
+	var err error
+	cert, key := b.cfg.GetString("telegram.webhook.cert"), b.cfg.GetString("telegram.webhook.key")
+	if cert != "" && b.cfg.GetBool("telegram.webhook.self_signed") {
+		_, err = b.api.UploadFile("setWebhook", params, "certificate", cert)
+	} else {
+		_, err = b.api.MakeRequest("setWebhook", params)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to set webhook: %w", err)
+	}
+	b.polled.Beat()
+	log.WithField("url", params["url"]).Info("Webhook is set")
+
+	go func() {
+		log.Infof("Listening for webhook updates on %s", b.hook.Addr)
+		if cert != "" {
+			err = b.hook.ListenAndServeTLS(cert, key)
+		} else {
+			err = b.hook.ListenAndServe()
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Errorf("Webhook server has stopped: %v", err)
+		}
+	}()
+	go b.watchWebhook(params["url"])
+
+	return b.updates, nil
+}
+
+// handleWebhook verifies the secret token of the webhook request and passes the update to the updates channel
+func (b *Bot) handleWebhook(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	secret := []byte(b.cfg.GetString("telegram.webhook.secret"))
+	if subtle.ConstantTimeCompare([]byte(r.Header.Get(secretHeader)), secret) != 1 {
+		log.WithField("remote_addr", r.RemoteAddr).Warn("Got webhook request with bad secret token")
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	var u tgbotapi.Update
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxWebhookBody)).Decode(&u); err != nil {
+		log.Warnf("Unable to decode webhook update: %v", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	select {
+	case b.updates <- u:
+		w.WriteHeader(http.StatusOK)
+	case <-b.stop:
+		w.WriteHeader(http.StatusServiceUnavailable)
+	case <-r.Context().Done():
+	}
+}
+
+// watchWebhook periodically checks that the webhook is still set, reporting the delivery errors
+func (b *Bot) watchWebhook(hookURL string) {
+	ticker := time.NewTicker(time.Duration(b.cfg.GetInt("telegram.timeout")) * time.Second)
+	defer ticker.Stop()
+
+	lastErrorDate := 0
+	for {
+		select {
+		case <-ticker.C:
+			info, err := b.api.GetWebhookInfo()
+			if err != nil {
+				log.Errorf("Unable to get webhook info: %v", err)
+				continue
+			}
+			if info.URL != hookURL {
+				log.Errorf("Webhook is set to '%s' instead of '%s'", info.URL, hookURL)
+				continue
+			}
+			if info.LastErrorDate != lastErrorDate {
+				lastErrorDate = info.LastErrorDate
+				log.Warnf("Telegram was unable to deliver the webhook update: %s", info.LastErrorMessage)
+			}
+			b.polled.Beat()
+		case <-b.stop:
+			return
+		}
+	}
+}
+
+// stopWebhook deletes the webhook and stops its server
+func (b *Bot) stopWebhook() {
+	if _, err := b.api.MakeRequest("deleteWebhook", nil); err != nil {
+		log.Errorf("Unable to delete webhook: %v", err)
+	} else {
+		log.Info("Webhook is deleted")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := b.hook.Shutdown(ctx); err != nil {
+		log.Errorf("Unable to shut down webhook server: %v", err)
+	}
+}
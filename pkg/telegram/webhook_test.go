@@ -0,0 +1,69 @@
+package telegram
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/spf13/viper"
+)
+
+func TestHandleWebhook(t *testing.T) {
+	const secret = "s3cr3t"
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		secret  string
+		body    string
+		stopped bool
+		status  int
+	}{
+		{"update", http.MethodPost, "/hook", secret, `{"update_id": 42}`, false, http.StatusOK},
+		{"bad method", http.MethodGet, "/hook", secret, "", false, http.StatusMethodNotAllowed},
+		{"no secret", http.MethodPost, "/hook", "", `{"update_id": 42}`, false, http.StatusUnauthorized},
+		{"bad secret", http.MethodPost, "/hook", "wrong", `{"update_id": 42}`, false, http.StatusUnauthorized},
+		{"bad body", http.MethodPost, "/hook", secret, `{"update_id":`, false, http.StatusBadRequest},
+		{"stopped", http.MethodPost, "/hook", secret, `{"update_id": 42}`, true, http.StatusServiceUnavailable},
+		{"other path", http.MethodPost, "/other", secret, `{"update_id": 42}`, false, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := viper.New()
+			cfg.Set("telegram.webhook.url", "https://bot.example.com/hook")
+			cfg.Set("telegram.webhook.secret", secret)
+			b := &Bot{cfg: cfg, updates: make(chan tgbotapi.Update, 1), stop: make(chan struct{})}
+			if tt.stopped {
+				// the update can't be passed to the stopped bot
+				b.updates = make(chan tgbotapi.Update)
+				close(b.stop)
+			}
+			srv, err := b.newWebhookServer()
+			if err != nil {
+				t.Fatalf("unable to create webhook server: %v", err)
+			}
+
+			r := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			if tt.secret != "" {
+				r.Header.Set(secretHeader, tt.secret)
+			}
+			w := httptest.NewRecorder()
+			srv.Handler.ServeHTTP(w, r)
+
+			if w.Code != tt.status {
+				t.Fatalf("%s %s = %d, want %d", tt.method, tt.path, w.Code, tt.status)
+			}
+			if tt.status != http.StatusOK {
+				if len(b.updates) > 0 {
+					t.Error("refused update is passed to the bot")
+				}
+				return
+			}
+			if u := <-b.updates; u.UpdateID != 42 {
+				t.Errorf("got update %d, want 42", u.UpdateID)
+			}
+		})
+	}
+}
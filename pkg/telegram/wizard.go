@@ -0,0 +1,178 @@
+package telegram
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/nezorflame/opengapps-mirror-bot/internal/pkg/i18n"
+	"github.com/nezorflame/opengapps-mirror-bot/internal/pkg/storage"
+	"github.com/nezorflame/opengapps-mirror-bot/pkg/gapps"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	wizardPrefix    = "mirror"
+	wizardSeparator = ":"
+	wizardRowSize   = 4
+	wizardMaxDates  = 8
+)
+
+// wizard starts the guided /mirror flow with the platform selection
+func (b *Bot) wizard(l *i18n.Localizer, msg *tgbotapi.Message) {
+	s, ok := b.gs.Get(storage.CurrentStorageKey)
+	if !ok {
+		log.WithField("chat_id", msg.Chat.ID).Error("No current storage available")
+		b.reply(msg.Chat.ID, msg.MessageID, l.T("errors.unknown", nil))
+		return
+	}
+
+	buttons := make([]tgbotapi.InlineKeyboardButton, 0, len(gapps.PlatformValues()))
+	for _, p := range s.Platforms() {
+		buttons = append(buttons, tgbotapi.NewInlineKeyboardButtonData(p.String(), wizardNext(nil, p.String())))
+	}
+	if len(buttons) == 0 {
+		b.reply(msg.Chat.ID, msg.MessageID, l.T("mirror.not_found", nil))
+		return
+	}
+
+	reply := tgbotapi.NewMessage(msg.Chat.ID, l.T("wizard.platform", nil))
+	reply.ReplyToMessageID = msg.MessageID
+	reply.ReplyMarkup = wizardKeyboard(buttons)
+	if _, err := b.api.Send(reply); err != nil {
+		log.Errorf("Unable to send the message: %v", err)
+	}
+}
+
+// callback handles the callback queries from the inline keyboards
+func (b *Bot) callback(q *tgbotapi.CallbackQuery) {
+	b.answerCallback(q.ID, "")
+	if q.Message == nil || !strings.HasPrefix(q.Data, wizardPrefix+wizardSeparator) {
+		return
+	}
+
+	logger := log.WithField("chat_id", q.Message.Chat.ID).WithField("msg_id", q.Message.MessageID)
+	l := b.lang(q.From)
+	args := strings.Split(q.Data, wizardSeparator)[1:]
+	if err := b.wizardStep(l, q.Message, q.From.ID, args); err != nil {
+		logger.Warnf("Unable to process the wizard step '%s': %v", q.Data, err)
+		b.editWizard(q.Message, l.T("errors.mirror", nil), nil)
+	}
+}
+
+// answerCallback answers the callback query, showing the text to the user if it's set
+func (b *Bot) answerCallback(id, text string) {
+	if _, err := b.api.Request(tgbotapi.NewCallback(id, text)); err != nil {
+		log.Errorf("Unable to answer the callback query: %v", err)
+	}
+}
+
+// wizardStep shows the next wizard step of the user based on the already selected args
+func (b *Bot) wizardStep(l *i18n.Localizer, msg *tgbotapi.Message, userID int, args []string) error {
+	s, ok := b.gs.Get(storage.CurrentStorageKey)
+	if !ok {
+		return fmt.Errorf("no current storage available")
+	}
+
+	var (
+		platform gapps.Platform
+		android  gapps.Android
+		variant  gapps.Variant
+		err      error
+	)
+	if len(args) > 0 {
+		if platform, err = gapps.PlatformString(args[0]); err != nil {
+			return err
+		}
+	}
+	if len(args) > 1 {
+		if android, err = gapps.AndroidString(args[1]); err != nil {
+			return err
+		}
+	}
+	if len(args) > 2 {
+		if variant, err = gapps.VariantString(args[2]); err != nil {
+			return err
+		}
+	}
+
+	var (
+		text    string
+		buttons []tgbotapi.InlineKeyboardButton
+	)
+	switch len(args) {
+	case 1:
+		text = l.T("wizard.android", nil)
+		for _, a := range s.Androids(platform) {
+			buttons = append(buttons, tgbotapi.NewInlineKeyboardButtonData(a.HumanString(), wizardNext(args, a.String())))
+		}
+	case 2:
+		text = l.T("wizard.variant", nil)
+		for _, v := range s.Variants(platform, android) {
+			buttons = append(buttons, tgbotapi.NewInlineKeyboardButtonData(v.String(), wizardNext(args, v.String())))
+		}
+	case 3:
+		text = l.T("wizard.date", nil)
+		for _, date := range b.gs.Dates() {
+			if ds, ok := b.gs.Get(date); !ok {
+				continue
+			} else if _, ok = ds.Get(platform, android, variant); !ok {
+				continue
+			}
+			buttons = append(buttons, tgbotapi.NewInlineKeyboardButtonData(date, wizardNext(args, date)))
+			if len(buttons) == wizardMaxDates {
+				break
+			}
+		}
+	case 4:
+		b.editWizard(msg, l.T("wizard.done", i18n.Args{
+			"platform": platform,
+			"android":  android.HumanString(),
+			"variant":  variant,
+			"date":     args[3],
+		}), nil)
+		b.sendMirror(l, userID, msg.Chat.ID, msg.MessageID, platform, android, variant, args[3])
+		return nil
+	default:
+		return fmt.Errorf("bad number of arguments: %d", len(args))
+	}
+
+	if len(buttons) == 0 {
+		b.editWizard(msg, l.T("mirror.not_found", nil), nil)
+		return nil
+	}
+
+	markup := wizardKeyboard(buttons)
+	b.editWizard(msg, text, &markup)
+	return nil
+}
+
+func (b *Bot) editWizard(msg *tgbotapi.Message, text string, markup *tgbotapi.InlineKeyboardMarkup) {
+	edit := tgbotapi.NewEditMessageText(msg.Chat.ID, msg.MessageID, text)
+	edit.ParseMode = tgbotapi.ModeMarkdown
+	edit.ReplyMarkup = markup
+	if _, err := b.api.Send(edit); err != nil {
+		log.Errorf("Unable to edit the message: %v", err)
+	}
+}
+
+func wizardNext(args []string, next string) string {
+	data := make([]string, 0, len(args)+2)
+	data = append(data, wizardPrefix)
+	data = append(data, args...)
+	data = append(data, next)
+	return strings.Join(data, wizardSeparator)
+}
+
+func wizardKeyboard(buttons []tgbotapi.InlineKeyboardButton) tgbotapi.InlineKeyboardMarkup {
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for i := 0; i < len(buttons); i += wizardRowSize {
+		end := i + wizardRowSize
+		if end > len(buttons) {
+			end = len(buttons)
+		}
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(buttons[i:end]...))
+	}
+	return tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
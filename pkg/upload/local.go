@@ -0,0 +1,125 @@
+package upload
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// TypeLocal is the type of the local mirror
+const TypeLocal = "local"
+
+// Mover is implemented by the uploaders which can take over the downloaded file without reading it
+type Mover interface {
+	Uploader
+	// Move moves the file from src to the path (slash-separated, relative to the mirror root)
+	// and returns its public URL and the new file location. The src is left intact on failure,
+	// so that it can be uploaded instead.
+	Move(path, src string) (string, string, error)
+}
+
+// Remover is implemented by the uploaders which can delete the stored files
+type Remover interface {
+	Uploader
+	// Remove removes the path (slash-separated, relative to the mirror root) with everything under it
+	Remove(path string) error
+}
+
+// local stores the files in the local folder served by the web server
+type local struct {
+	name string
+	host string
+	url  string
+	root string
+	ttl  time.Duration
+}
+
+func newLocal(name string, cfg *viper.Viper) (*local, error) {
+	if err := mandatory(cfg, "url", "path", "host"); err != nil {
+		return nil, err
+	}
+	return &local{
+		name: name,
+		host: cfg.GetString("host"),
+		url:  cfg.GetString("url"),
+		root: cfg.GetString("path"),
+		ttl:  cfg.GetDuration("ttl"),
+	}, nil
+}
+
+func (l *local) Name() string {
+	return l.name
+}
+
+func (l *local) Host() string {
+	return l.host
+}
+
+func (l *local) TTL() time.Duration {
+	return l.ttl
+}
+
+func (l *local) Upload(ctx context.Context, path string, r io.Reader, _ int64) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", fmt.Errorf("upload aborted: %w", err)
+	}
+
+	dest, err := l.create(path)
+	if err != nil {
+		return "", err
+	}
+
+	file, err := os.OpenFile(dest, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0755)
+	if err != nil {
+		return "", fmt.Errorf("unable to create file: %w", err)
+	}
+	defer file.Close()
+
+	if _, err = io.Copy(file, r); err != nil {
+		_ = os.Remove(dest)
+		return "", fmt.Errorf("unable to write file: %w", err)
+	}
+	return fmt.Sprintf(l.url, path), nil
+}
+
+func (l *local) Move(path, src string) (string, string, error) {
+	dest, err := l.create(path)
+	if err != nil {
+		return "", "", err
+	}
+
+	if err = os.Chmod(src, 0755); err != nil {
+		return "", "", fmt.Errorf("unable to set file permissions: %w", err)
+	}
+
+	if err = os.Rename(src, dest); err != nil {
+		return "", "", fmt.Errorf("unable to move file: %w", err)
+	}
+	return fmt.Sprintf(l.url, path), dest, nil
+}
+
+func (l *local) Remove(path string) error {
+	dest := filepath.Join(l.root, filepath.FromSlash(path))
+	if rel, err := filepath.Rel(l.root, dest); err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return fmt.Errorf("path '%s' is outside of the mirror root", path)
+	}
+	if err := os.RemoveAll(dest); err != nil {
+		return fmt.Errorf("unable to remove '%s': %w", path, err)
+	}
+	return nil
+}
+
+// create creates the parent folders for the path and returns the full file path
+func (l *local) create(path string) (string, error) {
+	dest := filepath.Join(l.root, filepath.FromSlash(path))
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return "", fmt.Errorf("unable to create folder: %w", err)
+	}
+	return dest, nil
+}
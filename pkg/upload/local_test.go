@@ -0,0 +1,74 @@
+package upload
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLocal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "upload-test")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	root := filepath.Join(dir, "mirror")
+	l := &local{name: "local", url: "https://local.example.com/%s", root: root}
+
+	// upload
+	mirrorURL, err := l.Upload(context.Background(), testPath, bytes.NewReader(testFile), int64(len(testFile)))
+	if err != nil {
+		t.Fatalf("Upload() returned error: %v", err)
+	}
+	if mirrorURL != "https://local.example.com/"+testPath {
+		t.Errorf("Upload() URL = %s", mirrorURL)
+	}
+	if body, _ := ioutil.ReadFile(filepath.Join(root, filepath.FromSlash(testPath))); !bytes.Equal(body, testFile) {
+		t.Errorf("uploaded file has %d bytes, want %d", len(body), len(testFile))
+	}
+
+	// move
+	src := filepath.Join(dir, "download.zip")
+	if err = ioutil.WriteFile(src, testFile, 0600); err != nil {
+		t.Fatalf("unable to write file: %v", err)
+	}
+	movedPath := "x86/20200101/moved.zip"
+	if _, dest, err := l.Move(movedPath, src); err != nil {
+		t.Errorf("Move() returned error: %v", err)
+	} else if info, err := os.Stat(dest); err != nil || info.Mode().Perm() != 0755 {
+		t.Errorf("moved file is not readable: %v", err)
+	}
+	if _, err = os.Stat(src); !os.IsNotExist(err) {
+		t.Errorf("source file is left after the move: %v", err)
+	}
+
+	// the failed move leaves the source file to be uploaded instead
+	if err = ioutil.WriteFile(src, testFile, 0600); err != nil {
+		t.Fatalf("unable to write file: %v", err)
+	}
+	if _, _, err = l.Move(testPath+"/nested.zip", src); err == nil {
+		t.Error("Move() into the file succeeded, want error")
+	}
+	if _, err = os.Stat(src); err != nil {
+		t.Errorf("source file is lost after the failed move: %v", err)
+	}
+
+	// remove
+	for _, p := range []string{"", ".", "../mirror", "../other"} {
+		if err = l.Remove(p); err == nil {
+			t.Errorf("Remove(%q) outside of the root succeeded", p)
+		}
+	}
+	if err = l.Remove("arm64"); err != nil {
+		t.Errorf("Remove() returned error: %v", err)
+	}
+	if _, err = os.Stat(filepath.Join(root, "arm64")); !os.IsNotExist(err) {
+		t.Errorf("removed folder still exists: %v", err)
+	}
+	if _, err = os.Stat(filepath.Join(root, "x86")); err != nil {
+		t.Errorf("other folder is removed: %v", err)
+	}
+}
@@ -0,0 +1,167 @@
+package upload
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	s3Algorithm      = "AWS4-HMAC-SHA256"
+	s3Service        = "s3"
+	s3UnsignedBody   = "UNSIGNED-PAYLOAD"
+	s3DateFormat     = "20060102"
+	s3DateTimeFormat = "20060102T150405Z"
+	s3DefaultRegion  = "us-east-1"
+)
+
+// s3 uploads the files to the S3-compatible storage using the Signature V4
+type s3 struct {
+	name      string
+	host      string
+	endpoint  *url.URL
+	region    string
+	bucket    string
+	accessKey string
+	secretKey string
+	url       string
+	pathStyle bool
+	acl       string
+	ttl       time.Duration
+}
+
+func newS3(name string, cfg *viper.Viper) (*s3, error) {
+	if err := mandatory(cfg, "endpoint", "bucket", "access_key", "secret_key", "url", "host"); err != nil {
+		return nil, err
+	}
+	endpoint, err := url.Parse(cfg.GetString("endpoint"))
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse endpoint: %w", err)
+	}
+	cfg.SetDefault("region", s3DefaultRegion)
+	return &s3{
+		name:      name,
+		host:      cfg.GetString("host"),
+		endpoint:  endpoint,
+		region:    cfg.GetString("region"),
+		bucket:    cfg.GetString("bucket"),
+		accessKey: cfg.GetString("access_key"),
+		secretKey: cfg.GetString("secret_key"),
+		url:       cfg.GetString("url"),
+		pathStyle: cfg.GetBool("path_style"),
+		acl:       cfg.GetString("acl"),
+		ttl:       cfg.GetDuration("ttl"),
+	}, nil
+}
+
+func (s *s3) Name() string {
+	return s.name
+}
+
+func (s *s3) Host() string {
+	return s.host
+}
+
+func (s *s3) TTL() time.Duration {
+	return s.ttl
+}
+
+func (s *s3) Upload(ctx context.Context, filePath string, r io.Reader, size int64) (string, error) {
+	key := strings.TrimPrefix(path.Clean(filePath), "/")
+
+	u := *s.endpoint
+	if s.pathStyle {
+		u.Path = path.Join("/", u.Path, s.bucket, key)
+	} else {
+		u.Host = s.bucket + "." + u.Host
+		u.Path = path.Join("/", u.Path, key)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, u.String(), r)
+	if err != nil {
+		return "", fmt.Errorf("unable to create upload request: %w", err)
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", "application/zip")
+	if s.acl != "" {
+		req.Header.Set("X-Amz-Acl", s.acl)
+	}
+	s.sign(req, time.Now().UTC())
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("unable to make upload request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if err = checkResponse(resp, http.StatusOK); err != nil {
+		return "", fmt.Errorf("unable to make upload request: %w", err)
+	}
+	return fmt.Sprintf(s.url, key), nil
+}
+
+// sign adds the Signature V4 authorization to the request.
+// The payload is left unsigned to avoid reading the whole file twice.
+func (s *s3) sign(req *http.Request, now time.Time) {
+	date, dateTime := now.Format(s3DateFormat), now.Format(s3DateTimeFormat)
+	req.Header.Set("X-Amz-Date", dateTime)
+	req.Header.Set("X-Amz-Content-Sha256", s3UnsignedBody)
+
+	headers := map[string]string{
+		"host":                 req.URL.Host,
+		"x-amz-content-sha256": s3UnsignedBody,
+		"x-amz-date":           dateTime,
+	}
+	if s.acl != "" {
+		headers["x-amz-acl"] = s.acl
+	}
+	signed := make([]string, 0, len(headers))
+	for h := range headers {
+		signed = append(signed, h)
+	}
+	sort.Strings(signed)
+
+	var canonicalHeaders strings.Builder
+	for _, h := range signed {
+		canonicalHeaders.WriteString(h + ":" + headers[h] + "\n")
+	}
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		strings.Join(signed, ";"),
+		s3UnsignedBody,
+	}, "\n")
+
+	scope := strings.Join([]string{date, s.region, s3Service, "aws4_request"}, "/")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{s3Algorithm, dateTime, scope, hex.EncodeToString(requestHash[:])}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.secretKey), date)
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, s3Service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s3Algorithm, s.accessKey, scope, strings.Join(signed, ";"), signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
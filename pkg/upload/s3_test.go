@@ -0,0 +1,100 @@
+package upload
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+const testPath = "arm64/20200101/open_gapps-arm64-10.0-nano-20200101.zip"
+
+var testFile = bytes.Repeat([]byte("zip"), 100)
+
+func TestS3Sign(t *testing.T) {
+	endpoint, _ := url.Parse("https://s3.example.com")
+	s := &s3{
+		endpoint:  endpoint,
+		region:    "eu-central-1",
+		bucket:    "mirror",
+		accessKey: "AKIDEXAMPLE",
+		secretKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+		acl:       "public-read",
+	}
+	req := httptest.NewRequest(http.MethodPut, "https://mirror.s3.example.com/"+testPath, nil)
+	s.sign(req, time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC))
+
+	// calculated with the reference implementation of the Signature V4
+	want := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20200101/eu-central-1/s3/aws4_request, " +
+		"SignedHeaders=host;x-amz-acl;x-amz-content-sha256;x-amz-date, " +
+		"Signature=770232929f5cf515b60d94ed96586b8c1ff0212e7068ac32642b2c6482d7fd7c"
+	if got := req.Header.Get("Authorization"); got != want {
+		t.Errorf("Authorization = %s, want %s", got, want)
+	}
+	if got := req.Header.Get("X-Amz-Date"); got != "20200101T120000Z" {
+		t.Errorf("X-Amz-Date = %s, want 20200101T120000Z", got)
+	}
+}
+
+func TestS3Upload(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		ok     bool
+	}{
+		{"uploaded", http.StatusOK, true},
+		{"refused", http.StatusForbidden, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body []byte
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodPut || r.URL.Path != "/mirror/"+testPath {
+					t.Errorf("got %s %s, want PUT of the object", r.Method, r.URL.Path)
+				}
+				if !strings.HasPrefix(r.Header.Get("Authorization"), s3Algorithm+" Credential=key/") {
+					t.Errorf("request is not signed: %s", r.Header.Get("Authorization"))
+				}
+				if r.Header.Get("X-Amz-Acl") != "public-read" {
+					t.Errorf("X-Amz-Acl = %s, want public-read", r.Header.Get("X-Amz-Acl"))
+				}
+				body, _ = ioutil.ReadAll(r.Body)
+				w.WriteHeader(tt.status)
+			}))
+			defer srv.Close()
+
+			cfg := viper.New()
+			cfg.Set("mirrors.s3.type", TypeS3)
+			cfg.Set("mirrors.s3.endpoint", srv.URL)
+			cfg.Set("mirrors.s3.bucket", "mirror")
+			cfg.Set("mirrors.s3.access_key", "key")
+			cfg.Set("mirrors.s3.secret_key", "secret")
+			cfg.Set("mirrors.s3.url", "https://cdn.example.com/%s")
+			cfg.Set("mirrors.s3.host", "cdn.example.com")
+			cfg.Set("mirrors.s3.path_style", true)
+			cfg.Set("mirrors.s3.acl", "public-read")
+			u, err := New(cfg, "s3")
+			if err != nil {
+				t.Fatalf("unable to create uploader: %v", err)
+			}
+
+			mirrorURL, err := u.Upload(context.Background(), "/"+testPath, bytes.NewReader(testFile), int64(len(testFile)))
+			if (err == nil) != tt.ok {
+				t.Fatalf("Upload() error = %v, want ok %t", err, tt.ok)
+			}
+			if !bytes.Equal(body, testFile) {
+				t.Errorf("uploaded %d bytes, want %d", len(body), len(testFile))
+			}
+			if tt.ok && mirrorURL != "https://cdn.example.com/"+testPath {
+				t.Errorf("Upload() URL = %s", mirrorURL)
+			}
+		})
+	}
+}
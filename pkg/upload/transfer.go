@@ -0,0 +1,78 @@
+package upload
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+const defaultMaxDays = 7
+
+// transfer uploads the files to the transfer.sh-like service with a single PUT request
+type transfer struct {
+	name    string
+	host    string
+	url     string
+	maxDays int
+}
+
+func newTransfer(name string, cfg *viper.Viper) (*transfer, error) {
+	if err := mandatory(cfg, "url", "host"); err != nil {
+		return nil, err
+	}
+	cfg.SetDefault("max_days", defaultMaxDays)
+	return &transfer{
+		name:    name,
+		host:    cfg.GetString("host"),
+		url:     cfg.GetString("url"),
+		maxDays: cfg.GetInt("max_days"),
+	}, nil
+}
+
+func (t *transfer) Name() string {
+	return t.name
+}
+
+func (t *transfer) Host() string {
+	return t.host
+}
+
+func (t *transfer) TTL() time.Duration {
+	return time.Duration(t.maxDays) * 24 * time.Hour
+}
+
+func (t *transfer) Upload(ctx context.Context, filePath string, r io.Reader, size int64) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, fmt.Sprintf(t.url, path.Base(filePath)), r)
+	if err != nil {
+		return "", fmt.Errorf("unable to create upload request: %w", err)
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", "application/zip")
+	if t.maxDays > 0 {
+		req.Header.Set("Max-Days", strconv.Itoa(t.maxDays))
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("unable to make upload request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if err = checkResponse(resp, http.StatusOK); err != nil {
+		return "", fmt.Errorf("unable to make upload request: %w", err)
+	}
+
+	result, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("unable to read mirror response body: %w", err)
+	}
+	return strings.TrimSpace(string(result)), nil
+}
@@ -0,0 +1,133 @@
+package upload
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// Uploader types
+const (
+	TypeTransfer = "transfer"
+	TypeWebDAV   = "webdav"
+	TypeS3       = "s3"
+)
+
+// Uploader uploads the files to the mirror
+type Uploader interface {
+	// Name returns the mirror name from config
+	Name() string
+	// Host returns the host label of the mirror
+	Host() string
+	// Upload uploads the file to the path (slash-separated, relative to the mirror root)
+	// and returns its public URL
+	Upload(ctx context.Context, path string, r io.Reader, size int64) (string, error)
+	// TTL returns the lifetime of the uploaded files, 0 if they never expire
+	TTL() time.Duration
+}
+
+// New creates the Uploader configured in the 'mirrors.<name>' config section
+func New(cfg *viper.Viper, name string) (Uploader, error) {
+	sub := cfg.Sub("mirrors." + name)
+	if sub == nil {
+		return nil, fmt.Errorf("mirror '%s' is not configured", name)
+	}
+
+	var (
+		u   Uploader
+		err error
+	)
+	switch t := sub.GetString("type"); t {
+	case TypeLocal:
+		u, err = newLocal(name, sub)
+	case TypeTransfer:
+		u, err = newTransfer(name, sub)
+	case TypeWebDAV:
+		u, err = newWebDAV(name, sub)
+	case TypeS3:
+		u, err = newS3(name, sub)
+	default:
+		return nil, fmt.Errorf("unknown type '%s' of mirror '%s'", t, name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to create mirror '%s': %w", name, err)
+	}
+	return u, nil
+}
+
+// FromConfig creates the uploaders for all the enabled mirrors from the 'mirrors' config section, sorted by name.
+// If the section is empty, the legacy 'gapps.local_*' and 'gapps.remote_*' parameters are used instead.
+func FromConfig(cfg *viper.Viper) ([]Uploader, error) {
+	mirrors := cfg.GetStringMap("mirrors")
+	if len(mirrors) == 0 {
+		return legacyFromConfig(cfg), nil
+	}
+
+	names := make([]string, 0, len(mirrors))
+	for name := range mirrors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	result := make([]Uploader, 0, len(names))
+	for _, name := range names {
+		key := "mirrors." + name + ".enabled"
+		if cfg.IsSet(key) && !cfg.GetBool(key) {
+			continue
+		}
+
+		u, err := New(cfg, name)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, u)
+	}
+	return result, nil
+}
+
+func legacyFromConfig(cfg *viper.Viper) []Uploader {
+	var result []Uploader
+	if cfg.GetString("gapps.local_url") != "" && cfg.GetString("gapps.local_path") != "" {
+		result = append(result, &local{
+			name: "local",
+			host: cfg.GetString("gapps.local_host"),
+			url:  cfg.GetString("gapps.local_url"),
+			root: cfg.GetString("gapps.local_path"),
+		})
+	}
+	if cfg.GetString("gapps.remote_url") != "" {
+		result = append(result, &transfer{
+			name:    "remote",
+			host:    cfg.GetString("gapps.remote_host"),
+			url:     cfg.GetString("gapps.remote_url"),
+			maxDays: defaultMaxDays,
+		})
+	}
+	return result
+}
+
+func checkResponse(resp *http.Response, codes ...int) error {
+	for _, c := range codes {
+		if resp.StatusCode == c {
+			return nil
+		}
+	}
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+	return fmt.Errorf("bad response status: %s: %s", resp.Status, body)
+}
+
+func mandatory(cfg *viper.Viper, keys ...string) error {
+	for _, k := range keys {
+		if cfg.GetString(k) == "" {
+			return errors.New("empty config value '" + k + "'")
+		}
+	}
+	return nil
+}
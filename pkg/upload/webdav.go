@@ -0,0 +1,116 @@
+package upload
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+const methodMkcol = "MKCOL"
+
+// webDAV uploads the files to the WebDAV server, creating the missing collections
+type webDAV struct {
+	name     string
+	host     string
+	endpoint string
+	url      string
+	username string
+	password string
+	ttl      time.Duration
+}
+
+func newWebDAV(name string, cfg *viper.Viper) (*webDAV, error) {
+	if err := mandatory(cfg, "endpoint", "url", "host"); err != nil {
+		return nil, err
+	}
+	return &webDAV{
+		name:     name,
+		host:     cfg.GetString("host"),
+		endpoint: strings.TrimSuffix(cfg.GetString("endpoint"), "/"),
+		url:      cfg.GetString("url"),
+		username: cfg.GetString("username"),
+		password: cfg.GetString("password"),
+		ttl:      cfg.GetDuration("ttl"),
+	}, nil
+}
+
+func (w *webDAV) Name() string {
+	return w.name
+}
+
+func (w *webDAV) Host() string {
+	return w.host
+}
+
+func (w *webDAV) TTL() time.Duration {
+	return w.ttl
+}
+
+func (w *webDAV) Upload(ctx context.Context, filePath string, r io.Reader, size int64) (string, error) {
+	filePath = strings.TrimPrefix(path.Clean(filePath), "/")
+
+	// create all the parent collections one by one
+	dirs := strings.Split(path.Dir(filePath), "/")
+	for i := range dirs {
+		if dirs[i] == "." {
+			break
+		}
+		if err := w.mkcol(ctx, strings.Join(dirs[:i+1], "/")); err != nil {
+			return "", err
+		}
+	}
+
+	req, err := w.request(ctx, http.MethodPut, filePath, r)
+	if err != nil {
+		return "", fmt.Errorf("unable to create upload request: %w", err)
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", "application/zip")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("unable to make upload request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if err = checkResponse(resp, http.StatusOK, http.StatusCreated, http.StatusNoContent); err != nil {
+		return "", fmt.Errorf("unable to make upload request: %w", err)
+	}
+	return fmt.Sprintf(w.url, filePath), nil
+}
+
+func (w *webDAV) mkcol(ctx context.Context, dir string) error {
+	req, err := w.request(ctx, methodMkcol, dir+"/", nil)
+	if err != nil {
+		return fmt.Errorf("unable to create MKCOL request: %w", err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("unable to make MKCOL request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// 405 is returned when the collection already exists
+	if err = checkResponse(resp, http.StatusCreated, http.StatusMethodNotAllowed); err != nil {
+		return fmt.Errorf("unable to create collection '%s': %w", dir, err)
+	}
+	return nil
+}
+
+func (w *webDAV) request(ctx context.Context, method, filePath string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, w.endpoint+"/"+filePath, body)
+	if err != nil {
+		return nil, err
+	}
+	if w.username != "" {
+		req.SetBasicAuth(w.username, w.password)
+	}
+	return req, nil
+}
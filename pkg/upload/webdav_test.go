@@ -0,0 +1,97 @@
+package upload
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestWebDAVUpload(t *testing.T) {
+	tests := []struct {
+		name string
+		// existing collections return 405 to MKCOL, the broken ones 409
+		existing, broken string
+		ok               bool
+	}{
+		{"new collections", "", "", true},
+		{"existing collection", "/dav/arm64/", "", true},
+		{"broken collection", "", "/dav/arm64/20200101/", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				requests []string
+				body     []byte
+				mtx      sync.Mutex
+			)
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mtx.Lock()
+				requests = append(requests, r.Method+" "+r.URL.Path)
+				mtx.Unlock()
+				if user, pass, ok := r.BasicAuth(); !ok || user != "bot" || pass != "secret" {
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+				switch {
+				case r.Method == methodMkcol && r.URL.Path == tt.existing:
+					w.WriteHeader(http.StatusMethodNotAllowed)
+				case r.Method == methodMkcol && r.URL.Path == tt.broken:
+					w.WriteHeader(http.StatusConflict)
+				case r.Method == methodMkcol:
+					w.WriteHeader(http.StatusCreated)
+				case r.Method == http.MethodPut:
+					body, _ = ioutil.ReadAll(r.Body)
+					w.WriteHeader(http.StatusCreated)
+				}
+			}))
+			defer srv.Close()
+
+			cfg := viper.New()
+			cfg.Set("endpoint", srv.URL+"/dav/")
+			cfg.Set("url", "https://dav.example.com/%s")
+			cfg.Set("host", "dav.example.com")
+			cfg.Set("username", "bot")
+			cfg.Set("password", "secret")
+			w, err := newWebDAV("dav", cfg)
+			if err != nil {
+				t.Fatalf("unable to create uploader: %v", err)
+			}
+
+			mirrorURL, err := w.Upload(context.Background(), testPath, bytes.NewReader(testFile), int64(len(testFile)))
+			if !tt.ok {
+				if err == nil {
+					t.Fatal("Upload() succeeded, want error")
+				}
+				if last := requests[len(requests)-1]; last != methodMkcol+" "+tt.broken {
+					t.Errorf("last request = %s, want the failed MKCOL", last)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Upload() returned error: %v", err)
+			}
+
+			want := []string{
+				methodMkcol + " /dav/arm64/",
+				methodMkcol + " /dav/arm64/20200101/",
+				http.MethodPut + " /dav/" + testPath,
+			}
+			if strings.Join(requests, ", ") != strings.Join(want, ", ") {
+				t.Errorf("requests = %v, want %v", requests, want)
+			}
+			if !bytes.Equal(body, testFile) {
+				t.Errorf("uploaded %d bytes, want %d", len(body), len(testFile))
+			}
+			if mirrorURL != "https://dav.example.com/"+testPath {
+				t.Errorf("Upload() URL = %s", mirrorURL)
+			}
+		})
+	}
+}